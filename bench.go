@@ -0,0 +1,87 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"github.com/Nik-U/pbc"
+	"sort"
+	"time"
+)
+
+// BenchResult holds the durations of the core operations on a pairing, as
+// measured by Benchmark.
+type BenchResult struct {
+	// G1Exp and G2Exp are the durations of an exponentiation in G1 and G2.
+	G1Exp, G2Exp time.Duration
+	// Pairing is the duration of a single pairing.
+	Pairing time.Duration
+	// ProdPair8 is the duration of a product of 8 pairings.
+	ProdPair8 time.Duration
+	// Test is the duration of a test of a token that pins 3 agents.
+	Test time.Duration
+}
+
+// Number of untimed and timed runs of every operation in Benchmark.
+const (
+	benchWarmups = 2
+	benchRuns    = 7
+)
+
+// Benchmark times the core operations on the pairing of the system
+// parameters and returns the median durations. This can be used to compare
+// curves. Benchmark uses its own random keys and does not change the system
+// parameters, nor does it report to their metrics or logger.
+func (sp *SystemParameters) Benchmark() BenchResult {
+	sp.mustBeOpen()
+	// Copy the parameters without metrics and logger.
+	bsp := &SystemParameters{g1: sp.g1, g2: sp.g2, pairing: sp.pairing, params: sp.params, constantTime: sp.constantTime}
+
+	r := bsp.pairing.NewZr().Rand()
+	g1 := bsp.pairing.NewG1().Rand()
+	g2 := bsp.pairing.NewG2().Rand()
+	g1s := make([]*pbc.Element, 8)
+	g2s := make([]*pbc.Element, 8)
+	for i := range g1s {
+		g1s[i] = bsp.pairing.NewG1().Rand()
+		g2s[i] = bsp.pairing.NewG2().Rand()
+	}
+
+	rulegenerator, agents := NewSetupKey(bsp).GenerateKeys(3, 8)
+	rt, err := rulegenerator.NewToken([]int32{16, 42, 12})
+	if err != nil {
+		panic(err)
+	}
+	ct := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 12),
+	}
+	as := NewAlarmSystem(bsp, rt, "identifier")
+
+	return BenchResult{
+		G1Exp:     benchMedian(func() { bsp.pairing.NewG1().PowZn(g1, r) }),
+		G2Exp:     benchMedian(func() { bsp.pairing.NewG2().PowZn(g2, r) }),
+		Pairing:   benchMedian(func() { bsp.pairing.NewGT().Pair(g1, g2) }),
+		ProdPair8: benchMedian(func() { bsp.pairing.NewGT().ProdPairSlice(g1s, g2s) }),
+		Test:      benchMedian(func() { as.Test(ct) }),
+	}
+}
+
+// benchMedian runs op a few times without timing it, and returns the median
+// duration of the timed runs that follow.
+func benchMedian(op func()) time.Duration {
+	for i := 0; i < benchWarmups; i++ {
+		op()
+	}
+	durations := make([]time.Duration, benchRuns)
+	for i := range durations {
+		start := time.Now()
+		op()
+		durations[i] = time.Since(start)
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return durations[len(durations)/2]
+}
@@ -0,0 +1,28 @@
+package crypmonsys
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBenchmark(t *testing.T) {
+	metrics := new(CountingMetrics)
+	sp := NewSystemParameters(testSetupKey.sp.pairing)
+	sp.SetMetrics(metrics)
+	_, agents := NewSetupKey(sp).GenerateKeys(1, 8)
+	g1, g2 := sp.g1.Bytes(), sp.g2.Bytes()
+	gamma := agents[0].gamma.Bytes()
+
+	result := sp.Benchmark()
+	t.Logf("%+v", result)
+	if result.G1Exp <= 0 || result.G2Exp <= 0 || result.Pairing <= 0 || result.ProdPair8 <= 0 || result.Test <= 0 {
+		t.Fatalf("Benchmark returned a zero duration: %+v", result)
+	}
+
+	if !bytes.Equal(sp.g1.Bytes(), g1) || !bytes.Equal(sp.g2.Bytes(), g2) || !bytes.Equal(agents[0].gamma.Bytes(), gamma) {
+		t.Fatal("Benchmark changed the keys.")
+	}
+	if metrics.Tests.Load() != 0 || metrics.Tokens.Load() != 0 || metrics.Ciphertexts.Load() != 0 {
+		t.Fatal("Benchmark reported to the metrics of the system parameters.")
+	}
+}
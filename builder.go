@@ -0,0 +1,80 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"errors"
+)
+
+var (
+	// ErrDuplicateConstraint is an error that is issued when a constraint is
+	// added for an agent that is already constrained.
+	ErrDuplicateConstraint = errors.New("Agent is already constrained by the token.")
+
+	// ErrTokenBuilt is an error that is issued when a token builder is used
+	// after its token has been built.
+	ErrTokenBuilt = errors.New("Token has already been built.")
+)
+
+// TokenBuilder generates a rule token from constraints that are added one at
+// a time. Every constraint adds its components to the token right away, in
+// the same way NewToken does, so the work done for earlier constraints is kept.
+// Agents without a constraint are wildcards.
+type TokenBuilder struct {
+	rg *RuleGenerator
+	rt *RuleToken
+}
+
+// NewTokenBuilder returns a builder for a token without constraints.
+func (rg *RuleGenerator) NewTokenBuilder() *TokenBuilder {
+	return &TokenBuilder{rg: rg, rt: rg.emptyToken()}
+}
+
+// AddConstraint requires the agent with the given index to have the value.
+// Negative values are wildcards and leave the token unchanged. It returns
+// ErrInvalidAgentIndex if the agent is not known, ErrRuleValueOutOfRange if
+// the value does not fit the message space of the agent and
+// ErrDuplicateConstraint if the agent is already constrained.
+func (tb *TokenBuilder) AddConstraint(index int, value int32) error {
+	if tb.rt == nil {
+		return ErrTokenBuilt
+	}
+	if err := tb.rg.sp.checkOpen(); err != nil {
+		return err
+	}
+	if index < 0 || index >= len(tb.rg.agents) {
+		return ErrInvalidAgentIndex
+	}
+	if value < 0 {
+		return nil
+	}
+	if int64(value) > MaxMessage(len(tb.rg.agents[index].beta)) {
+		return ErrRuleValueOutOfRange
+	}
+	for _, v := range tb.rt.indices {
+		if v == index {
+			return ErrDuplicateConstraint
+		}
+	}
+	_, g2pp := tb.rg.sp.generatorPowers()
+	tb.rt.pin(tb.rg.sp, g2pp, index, tb.rg.agents[index], value)
+	return nil
+}
+
+// Build returns the token with the constraints added so far. The builder
+// cannot be used afterwards.
+func (tb *TokenBuilder) Build() (*RuleToken, error) {
+	if tb.rt == nil {
+		return nil, ErrTokenBuilt
+	}
+	if err := tb.rg.sp.checkOpen(); err != nil {
+		return nil, err
+	}
+	rt := tb.rt
+	tb.rt = nil
+	tb.rg.issued(rt)
+	return rt, nil
+}
@@ -0,0 +1,56 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestTokenBuilder(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(4, 8)
+	sp := testSetupKey.sp
+
+	builder := rulegenerator.NewTokenBuilder()
+	if err := builder.AddConstraint(3, 12); err != nil {
+		t.Fatal("Error adding constraint: ", err)
+	}
+	if err := builder.AddConstraint(1, 16); err != nil {
+		t.Fatal("Error adding constraint: ", err)
+	}
+	if err := builder.AddConstraint(1, 17); err != ErrDuplicateConstraint {
+		t.Fatal("Expected ErrDuplicateConstraint, got: ", err)
+	}
+	if err := builder.AddConstraint(4, 1); err != ErrInvalidAgentIndex {
+		t.Fatal("Expected ErrInvalidAgentIndex, got: ", err)
+	}
+	if err := builder.AddConstraint(0, 256); err != ErrRuleValueOutOfRange {
+		t.Fatal("Expected ErrRuleValueOutOfRange, got: ", err)
+	}
+	built, err := builder.Build()
+	if err != nil {
+		t.Fatal("Error building token: ", err)
+	}
+	if _, err := builder.Build(); err != ErrTokenBuilt {
+		t.Fatal("Expected ErrTokenBuilt, got: ", err)
+	}
+
+	dense, err := rulegenerator.NewToken([]int32{-1, 16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	builtCovered, builtArity := built.Coverage()
+	denseCovered, denseArity := dense.Coverage()
+	if len(builtCovered) != len(denseCovered) || builtCovered[0] != denseCovered[0] || builtCovered[1] != denseCovered[1] || builtArity != denseArity {
+		t.Fatalf("Built token covers %v, the dense token %v.", builtCovered, denseCovered)
+	}
+
+	for _, values := range [][]int32{{0, 16, 42, 12}, {255, 16, 0, 12}, {0, 16, 42, 13}, {0, 15, 42, 12}} {
+		ciphertexts := make([]*Ciphertext, len(agents))
+		for i, v := range values {
+			ciphertexts[i] = agents[i].NewCiphertext("identifier", v)
+		}
+		builtResult := NewAlarmSystem(sp, built, "identifier").Test(ciphertexts)
+		denseResult := NewAlarmSystem(sp, dense, "identifier").Test(ciphertexts)
+		if builtResult != denseResult || builtResult != (values[1] == 16 && values[3] == 12) {
+			t.Fatalf("Values %v: built token %v, dense token %v.", values, builtResult, denseResult)
+		}
+	}
+}
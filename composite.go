@@ -0,0 +1,132 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"errors"
+)
+
+// ErrInvalidLayout is an error that is issued when an attribute layout does
+// not fit in the message space of an agent, or when the number of values does
+// not match the number of attributes.
+var ErrInvalidLayout = errors.New("Attribute layout does not fit the values or the message space.")
+
+// ErrCompositeMismatch is an error that is issued when tokens generated by
+// NewTokenComposite are combined with tokens of other agents or with tokens
+// that are not composite.
+var ErrCompositeMismatch = errors.New("Composite tokens can only be combined with composite tokens of the same agent.")
+
+// AttributeLayout describes how the message space of an agent is partitioned
+// into attributes, for agents that report a composite status. Every entry is
+// the width in bits of an attribute. Attribute j takes its width plus one bits
+// of the beta slice, starting after the bits of attributes 0 to j-1; the extra
+// bit is a marker that is always set, so an encryption of one attribute never
+// matches a rule for another attribute, not even for the value 0.
+//
+// For example, the layout {1, 1, 4} describes two on/off attributes and a
+// 4-bit attribute, and needs 9 bits of message space.
+type AttributeLayout []int
+
+// Bits returns the number of bits of message space the layout needs.
+func (l AttributeLayout) Bits() int {
+	bits := 0
+	for _, w := range l {
+		bits += w + 1
+	}
+	return bits
+}
+
+// check returns ErrInvalidLayout if the layout does not fit in a message space
+// of bits bits or if the number of values differs from the number of
+// attributes. Encoded values are plaintexts, so the layout can take at most 31
+// bits.
+func (l AttributeLayout) check(bits, values int) error {
+	if len(l) == 0 || values != len(l) || l.Bits() > bits || l.Bits() > 31 {
+		return ErrInvalidLayout
+	}
+	for _, w := range l {
+		if w < 1 {
+			return ErrInvalidLayout
+		}
+	}
+	return nil
+}
+
+// encode returns the value in the message space of the agent that represents
+// value v of attribute j: v with the marker bit set, shifted to the partition
+// of the attribute. The value must fit in the width of the attribute.
+func (l AttributeLayout) encode(j int, v int32) int32 {
+	offset := 0
+	for _, w := range l[:j] {
+		offset += w + 1
+	}
+	return (v | 1<<l[j]) << offset
+}
+
+// NewCompositeCiphertext encrypts a composite status of the agent, with a value
+// for every attribute of the layout. It returns a ciphertext per attribute, in
+// the order of the layout: the PRF of the scheme covers the whole plaintext of
+// a ciphertext, so a single ciphertext could not leave any of its attributes
+// as a wildcard. The ciphertexts are tested as a whole against a token
+// generated with NewTokenComposite for the agent and the same layout, e.g.
+// with NewAlarmSystem(sp, rt, identifier).Test(ciphertexts), and are indexed by
+// attribute instead of by agent. It returns
+// ErrInvalidLayout if the layout does not fit the message space of the agent,
+// and ErrPlaintextOutOfRange if a value does not fit the width of its
+// attribute.
+func (a *Agent) NewCompositeCiphertext(identifier string, layout AttributeLayout, values []int32) ([]*Ciphertext, error) {
+	if err := layout.check(len(a.beta), len(values)); err != nil {
+		return nil, err
+	}
+	for j, v := range values {
+		if v < 0 || int64(v) > MaxMessage(layout[j]) {
+			return nil, ErrPlaintextOutOfRange
+		}
+	}
+	ct := make([]*Ciphertext, len(values))
+	for j, v := range values {
+		ct[j] = a.NewCiphertext(identifier, layout.encode(j, v))
+	}
+	return ct, nil
+}
+
+// NewTokenComposite generates a rule token over the attributes of the agent
+// with the given index, which match a composite ciphertext of the agent for
+// the same layout. There is a value for every attribute and negative values
+// represent a wildcard. The token pins attribute positions instead of agents,
+// but records its agent: it only matches ciphertexts of that agent, is
+// blocked when that agent is revoked and covers that agent. It returns ErrInvalidAgentIndex if the agent is not
+// known, ErrInvalidLayout if the layout does not fit the message space of the
+// agent, and ErrRuleValueOutOfRange if a value does not fit the width of its
+// attribute.
+func (rg *RuleGenerator) NewTokenComposite(index int, layout AttributeLayout, values []int32) (*RuleToken, error) {
+	if err := rg.sp.checkOpen(); err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(rg.agents) {
+		return nil, ErrInvalidAgentIndex
+	}
+	info := rg.agents[index]
+	if err := layout.check(len(info.beta), len(values)); err != nil {
+		return nil, err
+	}
+	for j, v := range values {
+		if int64(v) > MaxMessage(layout[j]) {
+			return nil, ErrRuleValueOutOfRange
+		}
+	}
+
+	r := rg.emptyToken()
+	r.composite, r.agent = true, index
+	_, g2pp := rg.sp.generatorPowers()
+	for j, v := range values {
+		if v >= 0 {
+			r.pin(rg.sp, g2pp, j, info, layout.encode(j, v))
+		}
+	}
+	rg.issued(r)
+	return r, nil
+}
@@ -0,0 +1,130 @@
+package crypmonsys
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompositeCiphertext(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 9)
+	sp := testSetupKey.sp
+
+	// Door (open/closed), motion (yes/no) and a 4-bit temperature.
+	layout := AttributeLayout{1, 1, 4}
+
+	// The door is open and the temperature is 9, regardless of motion.
+	ruletoken, err := rulegenerator.NewTokenComposite(1, layout, []int32{1, Wildcard, 9})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	alarmsystem := NewAlarmSystem(sp, ruletoken, "identifier")
+
+	tests := []struct {
+		values []int32
+		match  bool
+	}{
+		{[]int32{1, 0, 9}, true},
+		{[]int32{1, 1, 9}, true},
+		{[]int32{0, 1, 9}, false},
+		{[]int32{1, 1, 8}, false},
+	}
+	for _, test := range tests {
+		ciphertexts, err := agents[1].NewCompositeCiphertext("identifier", layout, test.values)
+		if err != nil {
+			t.Fatal("Error creating composite ciphertext: ", err)
+		}
+		if alarmsystem.Test(ciphertexts) != test.match {
+			t.Fatalf("Unexpected result for values %v.", test.values)
+		}
+	}
+
+	// A composite ciphertext of another agent does not match.
+	ciphertexts, err := agents[0].NewCompositeCiphertext("identifier", layout, []int32{1, 0, 9})
+	if err != nil {
+		t.Fatal("Error creating composite ciphertext: ", err)
+	}
+	if alarmsystem.Test(ciphertexts) {
+		t.Fatal("Token matched the composite ciphertext of another agent.")
+	}
+
+	if _, err := agents[1].NewCompositeCiphertext("identifier", layout, []int32{1, 2, 9}); err != ErrPlaintextOutOfRange {
+		t.Fatal("Expected ErrPlaintextOutOfRange, got: ", err)
+	}
+	if _, err := agents[1].NewCompositeCiphertext("identifier", AttributeLayout{4, 4}, []int32{1, 1}); err != ErrInvalidLayout {
+		t.Fatal("Expected ErrInvalidLayout for a layout that needs 10 bits, got: ", err)
+	}
+	if _, err := rulegenerator.NewTokenComposite(1, layout, []int32{1, 1}); err != ErrInvalidLayout {
+		t.Fatal("Expected ErrInvalidLayout for missing values, got: ", err)
+	}
+	if _, err := rulegenerator.NewTokenComposite(1, layout, []int32{1, 1, 16}); err != ErrRuleValueOutOfRange {
+		t.Fatal("Expected ErrRuleValueOutOfRange, got: ", err)
+	}
+}
+
+func TestCompositeTokenAgent(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 9)
+	sp := testSetupKey.sp
+
+	layout := AttributeLayout{1, 1, 4}
+	ruletoken, err := rulegenerator.NewTokenComposite(1, layout, []int32{1, Wildcard, 9})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts, err := agents[1].NewCompositeCiphertext("identifier", layout, []int32{1, 0, 9})
+	if err != nil {
+		t.Fatal("Error creating composite ciphertext: ", err)
+	}
+
+	if covered, arity := ruletoken.Coverage(); len(covered) != 1 || covered[0] != 1 || arity != 2 {
+		t.Fatalf("Unexpected coverage %v, %d.", covered, arity)
+	}
+
+	alarmsystem := NewAlarmSystem(sp, ruletoken, "identifier")
+	alarmsystem.SetRevoked(0)
+	if match, err := alarmsystem.TestChecked(ciphertexts); !match || err != nil {
+		t.Fatal("Revoking another agent blocked the composite token: ", err)
+	}
+	alarmsystem.SetRevoked(1)
+	if _, err := alarmsystem.TestChecked(ciphertexts); !errors.Is(err, ErrRevokedAgent) {
+		t.Fatal("Expected ErrRevokedAgent for the agent of the composite token, got: ", err)
+	}
+
+	data, err := ruletoken.MarshalBinary()
+	if err != nil {
+		t.Fatal("Error marshaling token: ", err)
+	}
+	decoded, err := sp.UnmarshalRuleToken(data)
+	if err != nil {
+		t.Fatal("Error unmarshaling token: ", err)
+	}
+	if !NewAlarmSystem(sp, decoded, "identifier").Test(ciphertexts) {
+		t.Fatal("Decoded composite token did not match.")
+	}
+	if covered, _ := decoded.Coverage(); len(covered) != 1 || covered[0] != 1 {
+		t.Fatalf("Decoded composite token covers %v.", covered)
+	}
+	if decoded.Fingerprint() != ruletoken.Fingerprint() {
+		t.Fatal("Decoded composite token has a different fingerprint.")
+	}
+
+	// The same elements for another agent, or as a token that is not
+	// composite, make a different token.
+	moved := decoded.clone(sp)
+	moved.agent = 0
+	plain := decoded.clone(sp)
+	plain.composite, plain.agent = false, 0
+	if moved.Fingerprint() == ruletoken.Fingerprint() || plain.Fingerprint() == ruletoken.Fingerprint() || moved.Fingerprint() == plain.Fingerprint() {
+		t.Fatal("Composite tokens for different agents share a fingerprint.")
+	}
+
+	other, err := rulegenerator.NewToken([]int32{-1, 3})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	if _, err := sp.CombineTokens(ruletoken, other); err != ErrCompositeMismatch {
+		t.Fatal("Expected ErrCompositeMismatch, got: ", err)
+	}
+	if _, err := sp.CombineTokens(ruletoken, decoded); err != nil {
+		t.Fatal("Error combining composite tokens of the same agent: ", err)
+	}
+}
@@ -9,9 +9,19 @@
 package crypmonsys
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/Nik-U/pbc"
+	"iter"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
 )
 
 // SystemParameters holds the system parameters of the scheme. This includes
@@ -19,6 +29,104 @@ import (
 type SystemParameters struct {
 	g1, g2  *pbc.Element
 	pairing *pbc.Pairing
+	// params holds the pbc parameters of the pairing, if known.
+	params  string
+	metrics Metrics
+	// constantTime selects the constant-time comparison in Test.
+	constantTime bool
+	// logger receives security-relevant events, if set.
+	logger *slog.Logger
+
+	// Preprocessed powers of the generators, initialized on first use.
+	powersOnce sync.Once
+	g1pp, g2pp *pbc.Power
+
+	// Byte lengths of the group elements, initialized on first use.
+	sizesOnce    sync.Once
+	elementSizes elementSizes
+
+	// closed is set by Close.
+	closed bool
+}
+
+// Close releases the generators and their preprocessed powers and marks the
+// system parameters as unusable. Afterwards, methods that return an error
+// return ErrClosed and other methods panic with ErrClosed. All agents, rule
+// generators, tokens and alarm systems derived from the system parameters
+// become invalid. The pairing itself is not released, as it may be shared with
+// other system parameters.
+//
+// pbc frees the C memory of an element when it is garbage collected, so Close
+// drops the references of the system parameters to make that memory
+// reclaimable; it cannot free memory still referenced elsewhere. Close must not
+// be called concurrently with other uses of the system parameters. Closing
+// system parameters twice returns ErrClosed.
+func (sp *SystemParameters) Close() error {
+	if sp.closed {
+		return ErrClosed
+	}
+	sp.closed = true
+	sp.g1, sp.g2 = nil, nil
+	sp.g1pp, sp.g2pp = nil, nil
+	return nil
+}
+
+// checkOpen returns ErrClosed if the system parameters have been closed.
+func (sp *SystemParameters) checkOpen() error {
+	if sp.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// mustBeOpen panics with ErrClosed if the system parameters have been closed.
+func (sp *SystemParameters) mustBeOpen() {
+	if sp.closed {
+		panic(ErrClosed)
+	}
+}
+
+// elementSizes holds the byte lengths of the elements of the groups of a
+// pairing.
+type elementSizes struct {
+	g1, g2, gt, zr int
+}
+
+// sizes returns the byte lengths of the elements of the groups, which are
+// computed once.
+func (sp *SystemParameters) sizes() *elementSizes {
+	sp.sizesOnce.Do(func() {
+		sp.elementSizes = elementSizes{
+			g1: len(sp.pairing.NewG1().Bytes()),
+			g2: len(sp.pairing.NewG2().Bytes()),
+			gt: len(sp.pairing.NewGT().Bytes()),
+			zr: len(sp.pairing.NewZr().Bytes()),
+		}
+	})
+	return &sp.elementSizes
+}
+
+// G1Bytes returns the byte length of an element of G1.
+func (sp *SystemParameters) G1Bytes() int { return sp.sizes().g1 }
+
+// G2Bytes returns the byte length of an element of G2.
+func (sp *SystemParameters) G2Bytes() int { return sp.sizes().g2 }
+
+// GTBytes returns the byte length of an element of GT.
+func (sp *SystemParameters) GTBytes() int { return sp.sizes().gt }
+
+// ZrBytes returns the byte length of an element of Zr.
+func (sp *SystemParameters) ZrBytes() int { return sp.sizes().zr }
+
+// generatorPowers returns the preprocessed powers of g1 and g2, which speed up
+// the repeated exponentiations of the generators.
+func (sp *SystemParameters) generatorPowers() (g1pp, g2pp *pbc.Power) {
+	sp.mustBeOpen()
+	sp.powersOnce.Do(func() {
+		sp.g1pp = sp.g1.PreparePower()
+		sp.g2pp = sp.g2.PreparePower()
+	})
+	return sp.g1pp, sp.g2pp
 }
 
 // F implements a Pseudorandom Function (PRF) based on [NR04] that maps an input
@@ -26,39 +134,92 @@ type SystemParameters struct {
 // Please note that this function is definitely NOT implemented as a timing safe
 // function!
 func (sp *SystemParameters) F(group int, base *pbc.Element, beta []*pbc.Element, aux *pbc.Element, input int32) *pbc.Element {
-	br := sp.pairing.NewZr().Set1()
-	// Divide x by 2 (bitshift to right) until at zero
-	for x, i := input, 0; x > 0; i, x = i+1, x>>1 {
-		if x%2 == 1 {
-			br.ThenMulZn(beta[i])
-		}
-	}
+	br := sp.prfExponent(beta, input)
 	// The usage of aux is a small optimization that can reduce the number of
-	// exponentiations.
+	// exponentiations: F(..., aux, x) equals evaluatePRF(..., x)^aux.
 	br.ThenMulZn(aux)
 
-	var result *pbc.Element
+	return sp.newGroupElement(group).PowZn(base, br)
+}
 
+// evaluatePRF evaluates the PRF without folding in an aux element.
+func (sp *SystemParameters) evaluatePRF(group int, base *pbc.Element, beta []*pbc.Element, input int32) *pbc.Element {
+	return sp.newGroupElement(group).PowZn(base, sp.prfExponent(beta, input))
+}
+
+// prfExponent computes the product of the beta elements selected by the bits
+// of input. Negative inputs select no elements.
+func (sp *SystemParameters) prfExponent(beta []*pbc.Element, input int32) *pbc.Element {
+	return prfExponentInto(sp.pairing.NewZr(), beta, input)
+}
+
+// prfExponentInto computes the exponent of prfExponent into br.
+func prfExponentInto(br *pbc.Element, beta []*pbc.Element, input int32) *pbc.Element {
+	br.Set1()
+	if input <= 0 {
+		return br
+	}
+	// Divide x by 2 (bitshift to right) until at zero. The shift is done on an
+	// unsigned copy, so setting the highest bit cannot sign-extend.
+	for x, i := uint64(input), 0; x > 0; i, x = i+1, x>>1 {
+		if x&1 == 1 {
+			br.ThenMulZn(beta[i])
+		}
+	}
+	return br
+}
+
+// newGroupElement returns a new element of group 1 or group 2.
+func (sp *SystemParameters) newGroupElement(group int) *pbc.Element {
 	switch group {
 	case 1:
-		result = sp.pairing.NewG1()
+		return sp.pairing.NewG1()
 	case 2:
-		result = sp.pairing.NewG2()
+		return sp.pairing.NewG2()
 	default:
 		panic("Group should be either 1 or 2.")
 	}
+}
+
+// Option configures system parameters when they are created.
+type Option func(*SystemParameters)
+
+// WithHashedGenerators derives the generators g1 and g2 by hashing seed to
+// points of G1 and G2, instead of choosing them at random. System parameters
+// created for the same pairing parameters and seed have identical generators,
+// so they are interoperable without exchanging the generators.
+func WithHashedGenerators(seed string) Option {
+	return func(sp *SystemParameters) {
+		sp.g1 = sp.pairing.NewG1().SetFromStringHash(seed+"/g1", sha256.New())
+		sp.g2 = sp.pairing.NewG2().SetFromStringHash(seed+"/g2", sha256.New())
+	}
+}
 
-	return result.PowZn(base, br)
+// WithConstantTimeCompare makes tests compare the final elements of GT in
+// constant time, instead of with pbc's Equals, which may return at the first
+// difference and thereby leak how close non-matching ciphertexts are to
+// matching.
+func WithConstantTimeCompare() Option {
+	return func(sp *SystemParameters) {
+		sp.constantTime = true
+	}
 }
 
 // NewSystemParameters generates and returns new system parameters based on the
-// provided pairing.
-func NewSystemParameters(pairing *pbc.Pairing) *SystemParameters {
-	return &SystemParameters{
-		g1:      pairing.NewG1().Rand(),
-		g2:      pairing.NewG2().Rand(),
-		pairing: pairing,
+// provided pairing. The generators are chosen at random, unless an option
+// sets them.
+func NewSystemParameters(pairing *pbc.Pairing, opts ...Option) *SystemParameters {
+	sp := &SystemParameters{pairing: pairing}
+	for _, opt := range opts {
+		opt(sp)
 	}
+	if sp.g1 == nil {
+		sp.g1 = pairing.NewG1().Rand()
+	}
+	if sp.g2 == nil {
+		sp.g2 = pairing.NewG2().Rand()
+	}
+	return sp
 }
 
 // NewSystemParametersFromFile reads system parameters from a file.
@@ -67,6 +228,78 @@ func NewSystemParametersFromFile(filename string) *SystemParameters {
 	panic("Unimplemented!")
 }
 
+// NewSystemParametersFromParams generates new system parameters for the
+// pairing described by params. Unlike NewSystemParameters, the parameters are
+// recorded, so the system parameters can be serialized.
+func NewSystemParametersFromParams(params *pbc.Params, opts ...Option) *SystemParameters {
+	sp := NewSystemParameters(params.NewPairing(), opts...)
+	sp.params = params.String()
+	return sp
+}
+
+// NewSystemParametersFromParamFile generates new system parameters for the
+// pairing described by a file in the standard pbc parameter format, such as
+// the files in the param directory of pbc. The generators are chosen at random,
+// unless an option sets them.
+// Note that the construction is only secure for Type 3 pairings.
+// If the file cannot be read, the error from the file system is returned
+// wrapped; if the parameters cannot be parsed, the error wraps
+// ErrInvalidParams.
+func NewSystemParametersFromParamFile(path string, opts ...Option) (*SystemParameters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading parameter file: %w", err)
+	}
+	params, err := pbc.NewParamsFromString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	return NewSystemParametersFromParams(params, opts...), nil
+}
+
+// Compatible checks whether keys, ciphertexts and tokens of the system
+// parameters can be used together with those of other. This is the case if
+// both use the same pairing and the same generators. If the pbc parameters of
+// both pairings are known, they are compared; otherwise the sizes of the groups
+// of the pairings are compared. The returned error wraps
+// ErrIncompatibleParameters and describes the first difference found.
+func (sp *SystemParameters) Compatible(other *SystemParameters) error {
+	err := sp.compatible(other)
+	if errors.Is(err, ErrIncompatibleParameters) {
+		sp.logParameterMismatch(err)
+	}
+	return err
+}
+
+// compatible implements Compatible.
+func (sp *SystemParameters) compatible(other *SystemParameters) error {
+	if err := sp.checkOpen(); err != nil {
+		return err
+	}
+	if err := other.checkOpen(); err != nil {
+		return err
+	}
+	if sp == other {
+		return nil
+	}
+	if sp.pairing != other.pairing {
+		if sp.params != "" && other.params != "" {
+			if strings.TrimSpace(sp.params) != strings.TrimSpace(other.params) {
+				return fmt.Errorf("%w: pairing parameters differ", ErrIncompatibleParameters)
+			}
+		} else if *sp.sizes() != *other.sizes() {
+			return fmt.Errorf("%w: pairing group sizes differ", ErrIncompatibleParameters)
+		}
+	}
+	if !bytes.Equal(sp.g1.Bytes(), other.g1.Bytes()) {
+		return fmt.Errorf("%w: generator g1 differs", ErrIncompatibleParameters)
+	}
+	if !bytes.Equal(sp.g2.Bytes(), other.g2.Bytes()) {
+		return fmt.Errorf("%w: generator g2 differs", ErrIncompatibleParameters)
+	}
+	return nil
+}
+
 // SetupPart holds information (keys) about an agent needed in the setup
 // algorithm.
 type SetupPart struct {
@@ -80,6 +313,11 @@ type SetupPart struct {
 type SetupKey struct {
 	keys []SetupPart
 	sp   *SystemParameters
+	// seeded makes the key generation deterministic, derived from seed,
+	// which may be empty.
+	seeded  bool
+	seed    []byte
+	counter uint64
 }
 
 // Agent represents an agent in the system. It has all the information (keys
@@ -90,6 +328,16 @@ type Agent struct {
 	beta    []*pbc.Element
 	gamma   *pbc.Element
 	sp      *SystemParameters
+
+	// scratch holds the temporaries of NewCiphertextInto, allocated on first
+	// use.
+	scratch *ciphertextScratch
+}
+
+// ciphertextScratch holds elements that are reused across ciphertexts.
+type ciphertextScratch struct {
+	r, exponent   *pbc.Element
+	hID, hIDgamma *pbc.Element
 }
 
 // Ciphertext holds a ciphertext generated by an Agent.
@@ -98,20 +346,88 @@ type Ciphertext struct {
 	part1, part2 *pbc.Element
 }
 
+// MaxMessage returns the largest message of a message space of bits bits,
+// which is 2^bits - 1. It returns 0 if bits is less than 1 and is capped at
+// math.MaxInt64 for more than 63 bits.
+func MaxMessage(bits int) int64 {
+	switch {
+	case bits < 1:
+		return 0
+	case bits >= 63:
+		return math.MaxInt64
+	}
+	return int64(uint64(1)<<uint(bits) - 1)
+}
+
 // NewCiphertext creates a new ciphertext of a message that is attached to a
-// specific identifier.
+// specific identifier. It panics with ErrPlaintextOutOfRange if the plaintext
+// is larger than MaxMessage(a.MessageSpaceBits()).
 func (a *Agent) NewCiphertext(identifier string, plaintext int32) *Ciphertext {
+	if int64(plaintext) > MaxMessage(len(a.beta)) {
+		panic(ErrPlaintextOutOfRange)
+	}
 	hID := a.sp.pairing.NewG1().SetFromStringHash(identifier, sha256.New())
 	r := a.sp.pairing.NewZr().Rand()
 
 	// Compute g1^r
-	ct1 := a.sp.pairing.NewG1().PowZn(a.sp.g1, r)
+	g1pp, _ := a.sp.generatorPowers()
+	ct1 := a.sp.pairing.NewG1().PowerZn(g1pp, r)
 	// ct2 = F(SK1, beta, x)^r * H(ID)^\gamma
 	ct2 := a.sp.F(1, a.g1alpha, a.beta, r, plaintext).ThenMul(a.sp.pairing.NewG1().PowZn(hID, a.gamma))
 
+	a.sp.collector().IncCiphertexts()
 	return &Ciphertext{index: a.index, part1: ct1, part2: ct2}
 }
 
+// NewCiphertextInto encrypts the plaintext like NewCiphertext, but stores the
+// ciphertext in dst, reusing its elements, and reuses temporaries held by the
+// agent. This avoids allocations when many ciphertexts are generated. The
+// caller owns dst; a ciphertext stored in it is overwritten by the next call.
+// Because of the temporaries, NewCiphertextInto must not be called
+// concurrently for the same agent. It returns ErrPlaintextOutOfRange if the
+// plaintext does not fit in the message space of the agent.
+func (a *Agent) NewCiphertextInto(dst *Ciphertext, identifier string, plaintext int32) error {
+	if err := a.sp.checkOpen(); err != nil {
+		return err
+	}
+	if int64(plaintext) > MaxMessage(len(a.beta)) {
+		return ErrPlaintextOutOfRange
+	}
+	s := a.scratch
+	if s == nil {
+		s = &ciphertextScratch{
+			r:        a.sp.pairing.NewZr(),
+			exponent: a.sp.pairing.NewZr(),
+			hID:      a.sp.pairing.NewG1(),
+			hIDgamma: a.sp.pairing.NewG1(),
+		}
+		a.scratch = s
+	}
+	if dst.part1 == nil {
+		dst.part1 = a.sp.pairing.NewG1()
+	}
+	if dst.part2 == nil {
+		dst.part2 = a.sp.pairing.NewG1()
+	}
+
+	s.hID.SetFromStringHash(identifier, sha256.New())
+	s.r.Rand()
+	g1pp, _ := a.sp.generatorPowers()
+	dst.part1.PowerZn(g1pp, s.r)
+	prfExponentInto(s.exponent, a.beta, plaintext).ThenMulZn(s.r)
+	dst.part2.PowZn(a.g1alpha, s.exponent).ThenMul(s.hIDgamma.PowZn(s.hID, a.gamma))
+	dst.index = a.index
+
+	a.sp.collector().IncCiphertexts()
+	return nil
+}
+
+// MessageSpaceBits returns the size of the agent's message space in bits.
+// Plaintexts range from 0 up to and including 2^MessageSpaceBits() - 1.
+func (a *Agent) MessageSpaceBits() int {
+	return len(a.beta)
+}
+
 // AgentInfo holds information about the Agent with which a Rule Generator can
 // generate rules that use the status of that Agent.
 type AgentInfo struct {
@@ -125,6 +441,8 @@ type AgentInfo struct {
 type RuleGenerator struct {
 	agents []AgentInfo
 	sp     *SystemParameters
+	// names maps the names of agents to their indices.
+	names map[string]int
 }
 
 // RuleToken represents an encrypted rule (= token) defined over the output
@@ -134,20 +452,92 @@ type RuleToken struct {
 	g2u     []*pbc.Element
 	f2u     []*pbc.Element
 	product *pbc.Element
+
+	// composite is set for tokens generated by NewTokenComposite. Their
+	// indices are the positions of attributes in a composite ciphertext of
+	// the agent with index agent, instead of indices of agents.
+	composite bool
+	agent     int
 }
 
+// Wildcard is the rule value that does not constrain the status of an agent.
+// Any negative rule value is treated as a wildcard.
+const Wildcard int32 = -1
+
 var (
 	// ErrWrongNumberOfRules is an error that is issued when the supplied rule
 	// does not match the number of agents.
 	ErrWrongNumberOfRules = errors.New("Number of components in the rule does not match number of agents.")
+
+	// ErrRuleValueOutOfRange is an error that is issued when a component of
+	// the supplied rule does not fit in the message space of its agent.
+	ErrRuleValueOutOfRange = errors.New("Rule value does not fit in the message space of the agent.")
+
+	// ErrPlaintextOutOfRange is an error that is issued when a plaintext does
+	// not fit in the message space of the agent.
+	ErrPlaintextOutOfRange = errors.New("Plaintext does not fit in the message space of the agent.")
+
+	// ErrInvalidMessageSpace is an error that is issued when the requested
+	// size of a message space is not a positive number of bits.
+	ErrInvalidMessageSpace = errors.New("Message space should be at least one bit.")
+
+	// ErrMalformedToken is an error that is issued when the components of a
+	// rule token are inconsistent with each other.
+	ErrMalformedToken = errors.New("Components of the rule token are inconsistent.")
+
+	// ErrInvalidParams is an error that is issued when pairing parameters
+	// cannot be parsed.
+	ErrInvalidParams = errors.New("Invalid pairing parameters.")
+
+	// ErrIncompatibleParameters is an error that is issued when two sets of
+	// system parameters cannot be used together.
+	ErrIncompatibleParameters = errors.New("System parameters are incompatible")
+
+	// ErrClosed is an error that is issued when system parameters are used
+	// after they have been closed.
+	ErrClosed = errors.New("System parameters are closed.")
+
+	// ErrNoConstraints is an error that is issued when a rule for a strict
+	// token does not constrain any agent.
+	ErrNoConstraints = errors.New("Rule does not constrain any agent.")
+
+	// ErrRevokedAgent is an error that is issued when a token is tested that
+	// constrains an agent revoked with SetRevoked.
+	ErrRevokedAgent = errors.New("Token constrains a revoked agent")
 )
 
 // NewToken generates a new rule token. The rules are passed along in the form
 // of a slice of integers. Negative numbers represent a wildcard.
 func (rg *RuleGenerator) NewToken(rules []int32) (*RuleToken, error) {
+	r, _, err := rg.newToken(rules)
+	return r, err
+}
+
+// NewTokenStrict generates a new rule token like NewToken, but returns
+// ErrNoConstraints if all rules are wildcards. Such a token matches any set of
+// ciphertexts, which is rarely intended; use NewWildcardToken to generate one
+// explicitly.
+func (rg *RuleGenerator) NewTokenStrict(rules []int32) (*RuleToken, error) {
+	for _, v := range rules {
+		if v >= 0 {
+			return rg.NewToken(rules)
+		}
+	}
 	if len(rules) < len(rg.agents) {
 		return nil, ErrWrongNumberOfRules
 	}
+	return nil, ErrNoConstraints
+}
+
+// newToken generates a new rule token and returns it together with the
+// contribution g2gamma^u of every pinned agent to its product.
+func (rg *RuleGenerator) newToken(rules []int32) (*RuleToken, []*pbc.Element, error) {
+	if err := rg.sp.checkOpen(); err != nil {
+		return nil, nil, err
+	}
+	if len(rules) < len(rg.agents) {
+		return nil, nil, ErrWrongNumberOfRules
+	}
 	r := &RuleToken{
 		indices: make([]int, 0, len(rules)),
 		g2u:     make([]*pbc.Element, 0, len(rules)),
@@ -155,21 +545,123 @@ func (rg *RuleGenerator) NewToken(rules []int32) (*RuleToken, error) {
 		// Initialized to 1 as we will multiply it with something for each rule.
 		product: rg.sp.pairing.NewG2().Set1(),
 	}
+	contributions := make([]*pbc.Element, 0, len(rules))
 
+	_, g2pp := rg.sp.generatorPowers()
 	for i, v := range rules {
 		// For now, when the value of rule is negative it is considered a wildcard
 		if v >= 0 {
-			r.indices = append(r.indices, i)
-			u := rg.sp.pairing.NewZr().Rand()
-			r.g2u = append(r.g2u, rg.sp.pairing.NewG2().PowZn(rg.sp.g2, u))
-			// r.f2u = append(r.f2u, rg.sp.pairing.NewG2().PowZn(rg.sp.F(2, rg.agents[i].g2alpha, rg.agents[i].beta, v), u))
-			r.f2u = append(r.f2u, rg.sp.F(2, rg.agents[i].g2alpha, rg.agents[i].beta, u, v))
-			// TODO: Check what is more efficient, as it is written now or the following:
-			// r.F2u = append(r.F2u, rg.sp.F2(rg.sp.pairing.NewG2().PowZn(rg.agents[i].g2alpha, u), rg.agents[i].beta, y))
-			r.product.ThenMul(rg.sp.pairing.NewG2().PowZn(rg.agents[i].g2gamma, u))
+			if int64(v) > MaxMessage(len(rg.agents[i].beta)) {
+				return nil, nil, ErrRuleValueOutOfRange
+			}
+			contributions = append(contributions, r.pin(rg.sp, g2pp, i, rg.agents[i], v))
+		}
+	}
+	rg.issued(r)
+	return r, contributions, nil
+}
+
+// pin adds a component to the token that requires the ciphertext at position
+// i to encrypt v under the keys of the agent described by info. It returns the
+// contribution g2gamma^u of the component to the product.
+func (r *RuleToken) pin(sp *SystemParameters, g2pp *pbc.Power, i int, info AgentInfo, v int32) *pbc.Element {
+	r.indices = append(r.indices, i)
+	u := sp.pairing.NewZr().Rand()
+	r.g2u = append(r.g2u, sp.pairing.NewG2().PowerZn(g2pp, u))
+	// r.f2u = append(r.f2u, sp.pairing.NewG2().PowZn(sp.F(2, info.g2alpha, info.beta, v), u))
+	r.f2u = append(r.f2u, sp.F(2, info.g2alpha, info.beta, u, v))
+	// TODO: Check what is more efficient, as it is written now or the following:
+	// r.F2u = append(r.F2u, sp.F2(sp.pairing.NewG2().PowZn(info.g2alpha, u), info.beta, y))
+	contribution := sp.pairing.NewG2().PowZn(info.g2gamma, u)
+	r.product.ThenMul(contribution)
+	return contribution
+}
+
+// NewWildcardToken generates a rule token that constrains none of the agents.
+// Such a token matches any set of ciphertexts and can be used for health
+// checks.
+func (rg *RuleGenerator) NewWildcardToken() *RuleToken {
+	r := rg.emptyToken()
+	rg.issued(r)
+	return r
+}
+
+// emptyToken returns a token without any components, to which components can
+// be added with pin.
+func (rg *RuleGenerator) emptyToken() *RuleToken {
+	return &RuleToken{
+		indices: []int{},
+		g2u:     []*pbc.Element{},
+		f2u:     []*pbc.Element{},
+		product: rg.sp.pairing.NewG2().Set1(),
+	}
+}
+
+// issued records the generation of a token in the metrics and the log.
+func (rg *RuleGenerator) issued(r *RuleToken) {
+	rg.sp.collector().IncTokens()
+	rg.sp.logTokenIssued(r)
+}
+
+// NewTokenFromMap generates a new rule token from a map of agent indices to
+// rule values. Agents that are absent from the map are wildcards. It returns
+// ErrInvalidAgentIndex if a key is not the index of a known agent.
+func (rg *RuleGenerator) NewTokenFromMap(constraints map[int]int32) (*RuleToken, error) {
+	rules := make([]int32, len(rg.agents))
+	for i := range rules {
+		rules[i] = Wildcard
+	}
+	for i, v := range constraints {
+		if i < 0 || i >= len(rules) {
+			return nil, ErrInvalidAgentIndex
+		}
+		rules[i] = v
+	}
+	return rg.NewToken(rules)
+}
+
+// MessageSpaceBits returns the size in bits of the message space of the agents
+// known to the rule generator. All agents generated by GenerateKeys share the
+// same message space. If the rule generator knows no agents, or if the agents
+// do not agree on the size of their message space, 0 is returned.
+func (rg *RuleGenerator) MessageSpaceBits() int {
+	if len(rg.agents) == 0 {
+		return 0
+	}
+	bits := len(rg.agents[0].beta)
+	for _, info := range rg.agents[1:] {
+		if len(info.beta) != bits {
+			return 0
+		}
+	}
+	return bits
+}
+
+// NumAgents returns the number of agents known to the rule generator.
+func (rg *RuleGenerator) NumAgents() int {
+	return len(rg.agents)
+}
+
+// Agents returns an iterator over the index and information of every agent
+// known to the rule generator. Together with NewRuleGenerator this allows the
+// rule generator to be reconstructed.
+func (rg *RuleGenerator) Agents() iter.Seq2[int, AgentInfo] {
+	return func(yield func(int, AgentInfo) bool) {
+		for i, info := range rg.agents {
+			if !yield(i, info) {
+				return
+			}
 		}
 	}
-	return r, nil
+}
+
+// NewRuleGenerator creates a rule generator for the agents described by
+// agents, where the i-th element describes the agent with index i.
+func NewRuleGenerator(sp *SystemParameters, agents []AgentInfo) *RuleGenerator {
+	return &RuleGenerator{
+		agents: append([]AgentInfo(nil), agents...),
+		sp:     sp,
+	}
 }
 
 // NewSetupKey generates a new setup key based on the provided system parameters.
@@ -180,20 +672,73 @@ func NewSetupKey(sp *SystemParameters) *SetupKey {
 	}
 }
 
+// NewSetupKeyFromSeed generates a new setup key that derives all key material
+// deterministically from seed, so that the same seed always yields the same
+// keys. This is meant for tests and reproducible test vectors only: the keys
+// are only as secret as the seed.
+func NewSetupKeyFromSeed(sp *SystemParameters, seed []byte) *SetupKey {
+	sk := NewSetupKey(sp)
+	sk.seeded = true
+	sk.seed = append([]byte(nil), seed...)
+	return sk
+}
+
+// randomZr returns a random element of Zr, or the next element derived from
+// the seed if the setup key has one.
+func (sk *SetupKey) randomZr() *pbc.Element {
+	if !sk.seeded {
+		return sk.sp.pairing.NewZr().Rand()
+	}
+	h := sha256.New()
+	h.Write(sk.seed)
+	binary.Write(h, binary.BigEndian, sk.counter)
+	sk.counter++
+	return sk.sp.pairing.NewZr().SetFromHash(h.Sum(nil))
+}
+
 // GenerateKeys generates keys for the rule generator and the agents (for the
 // setup algorithm).
 func (sk *SetupKey) GenerateKeys(n, messageSpaceBitSize int) (rg *RuleGenerator, agents []*Agent) {
+	bitsPerAgent := make([]int, n)
+	for i := range bitsPerAgent {
+		bitsPerAgent[i] = messageSpaceBitSize
+	}
+	return sk.generateKeys(bitsPerAgent)
+}
+
+// GenerateKeysVariable generates keys for the rule generator and the agents,
+// where each agent has its own message space. The number of agents is the
+// length of bitsPerAgent and the i-th agent can encrypt values of at most
+// bitsPerAgent[i] bits.
+func (sk *SetupKey) GenerateKeysVariable(bitsPerAgent []int) (*RuleGenerator, []*Agent, error) {
+	if err := sk.sp.checkOpen(); err != nil {
+		return nil, nil, err
+	}
+	for _, bits := range bitsPerAgent {
+		if bits < 1 {
+			return nil, nil, ErrInvalidMessageSpace
+		}
+	}
+	rg, agents := sk.generateKeys(bitsPerAgent)
+	return rg, agents, nil
+}
+
+// generateKeys generates the keys for len(bitsPerAgent) agents. The size of
+// the message space of each agent is tracked by the length of its beta slice.
+func (sk *SetupKey) generateKeys(bitsPerAgent []int) (rg *RuleGenerator, agents []*Agent) {
+	sk.sp.mustBeOpen()
+	n := len(bitsPerAgent)
 	rg = &RuleGenerator{sp: sk.sp}
 	agents = make([]*Agent, n)
 	rg.agents = make([]AgentInfo, n)
 
 	for i := 0; i < n; i++ {
-		alpha := sk.sp.pairing.NewZr().Rand()
-		beta := make([]*pbc.Element, messageSpaceBitSize)
-		for j := 0; j < messageSpaceBitSize; j++ {
-			beta[j] = sk.sp.pairing.NewZr().Rand()
+		alpha := sk.randomZr()
+		beta := make([]*pbc.Element, bitsPerAgent[i])
+		for j := range beta {
+			beta[j] = sk.randomZr()
 		}
-		gamma := sk.sp.pairing.NewZr().Rand()
+		gamma := sk.randomZr()
 		agents[i] = &Agent{
 			index:   i,
 			g1alpha: sk.sp.pairing.NewG1().PowZn(sk.sp.g1, alpha),
@@ -209,12 +754,25 @@ func (sk *SetupKey) GenerateKeys(n, messageSpaceBitSize int) (rg *RuleGenerator,
 	return
 }
 
+// EstimateSetup estimates the memory used by the keys that GenerateKeys
+// produces for n agents with a message space of bits bits, without generating
+// them. It returns the number of group elements and their total size in bytes.
+// Every agent holds g1^alpha, its beta slice and gamma, and the rule generator
+// holds g2^alpha and g2^gamma for every agent and shares the beta slices with
+// the agents, so n * (bits + 4) elements are kept in total.
+func (sp *SystemParameters) EstimateSetup(n, bits int) (bytes int64, elements int) {
+	perAgent := int64(sp.G1Bytes()) + 2*int64(sp.G2Bytes()) + int64(bits+1)*int64(sp.ZrBytes())
+	return int64(n) * perAgent, n * (bits + 4)
+}
+
 // AlarmSystem represents the system that tests whether token and ciphertexts
 // match, without being able to see the content of the rules nor messages.
 type AlarmSystem struct {
 	sp  *SystemParameters
 	rt  *RuleToken
 	hID *pbc.Element
+	// revoked holds the indices of the agents set by SetRevoked.
+	revoked map[int]bool
 }
 
 // NewAlarmSystem creates a new alarm system.
@@ -226,16 +784,103 @@ func NewAlarmSystem(sp *SystemParameters, rt *RuleToken, identifier string) *Ala
 	}
 }
 
+// SetIdentifier binds the alarm system to a new identifier. Only the hash of
+// the identifier is recomputed; the token and system parameters stay bound, so
+// a single alarm system can process a stream of windows with distinct
+// identifiers.
+func (as *AlarmSystem) SetIdentifier(identifier string) {
+	as.hID.SetFromStringHash(identifier, sha256.New())
+}
+
 // Test is a function that tests whether the provided ciphertexts match the
-// token defined for the AlarmSystem.
+// token defined for the AlarmSystem. The ciphertext of agent i should be at
+// position i of ct; if a ciphertext for an agent pinned by the token is
+// missing, the ciphertexts do not match. A token that pins no agents only
+// compares the identifier with the token, so it matches any ciphertexts,
+// including none at all. A malformed token or a token that constrains a
+// revoked agent never matches; TestChecked reports the reason.
 func (as *AlarmSystem) Test(ct []*Ciphertext) bool {
-	parts1 := make([]*pbc.Element, len(as.rt.indices))
-	parts2 := make([]*pbc.Element, len(as.rt.indices))
-	for i, v := range as.rt.indices {
-		parts1[i], parts2[i] = ct[v].part1, ct[v].part2
-	}
-	p1 := as.sp.pairing.NewGT().ProdPairSlice(parts1, as.rt.f2u)
-	p1.ThenMul(as.sp.pairing.NewGT().Pair(as.hID, as.rt.product))
-	p2 := as.sp.pairing.NewGT().ProdPairSlice(parts2, as.rt.g2u)
-	return p1.Equals(p2)
+	match, _ := as.TestChecked(ct)
+	return match
+}
+
+// SetRevoked sets the agents whose ciphertexts the alarm system no longer
+// accepts, replacing the previously revoked agents. A token that constrains a
+// revoked agent never matches. This revokes agents without rotating keys and
+// can be changed for every test. Calling SetRevoked without indices revokes
+// no agents.
+func (as *AlarmSystem) SetRevoked(indices ...int) {
+	as.revoked = make(map[int]bool, len(indices))
+	for _, v := range indices {
+		as.revoked[v] = true
+	}
+	as.sp.logAgentsRevoked(indices)
+}
+
+// checkRevoked returns an error wrapping ErrRevokedAgent if the token
+// constrains a revoked agent.
+func (as *AlarmSystem) checkRevoked() error {
+	if len(as.revoked) == 0 {
+		return nil
+	}
+	for _, v := range as.rt.agents() {
+		if as.revoked[v] {
+			return fmt.Errorf("%w: agent %d", ErrRevokedAgent, v)
+		}
+	}
+	return nil
+}
+
+// TestChecked tests whether the provided ciphertexts match the token defined
+// for the AlarmSystem, like Test. It returns ErrMalformedToken if the token is
+// not well-formed, for example because it was corrupted or built by hand, and
+// an error wrapping ErrRevokedAgent if the token constrains a revoked agent.
+func (as *AlarmSystem) TestChecked(ct []*Ciphertext) (bool, error) {
+	if err := as.sp.checkOpen(); err != nil {
+		return false, err
+	}
+	if err := as.rt.check(); err != nil {
+		return false, err
+	}
+	if err := as.checkRevoked(); err != nil {
+		return false, err
+	}
+	return as.sp.test(as.rt, as.sp.pairing.NewGT().Pair(as.hID, as.rt.product), ct), nil
+}
+
+// test tests whether the ciphertexts match the well-formed rule token, where
+// idFactor is the pairing e(H(ID), product) of the token.
+func (sp *SystemParameters) test(rt *RuleToken, idFactor *pbc.Element, ct []*Ciphertext) bool {
+	metrics := sp.collector()
+	metrics.IncTests()
+	metrics.ObservePairings(2*len(rt.indices) + 1)
+
+	// pbc does not accept empty slices for a product of pairings, but the
+	// product over no pairings equals 1, so only idFactor remains.
+	if len(rt.indices) == 0 {
+		return idFactor.Is1()
+	}
+
+	parts1 := make([]*pbc.Element, len(rt.indices))
+	parts2 := make([]*pbc.Element, len(rt.indices))
+	for i, v := range rt.indices {
+		c := rt.ciphertextAt(ct, v)
+		if c == nil {
+			return false
+		}
+		parts1[i], parts2[i] = c.part1, c.part2
+	}
+	p1 := sp.pairing.NewGT().ProdPairSlice(parts1, rt.f2u)
+	p1.ThenMul(idFactor)
+	p2 := sp.pairing.NewGT().ProdPairSlice(parts2, rt.g2u)
+	return sp.equal(p1, p2)
+}
+
+// equal compares two elements, in constant time if the system parameters
+// were created with WithConstantTimeCompare.
+func (sp *SystemParameters) equal(x, y *pbc.Element) bool {
+	if sp.constantTime {
+		return subtle.ConstantTimeCompare(x.Bytes(), y.Bytes()) == 1
+	}
+	return x.Equals(y)
 }
@@ -1,12 +1,15 @@
 package crypmonsys
 
 import (
+	"errors"
 	"github.com/Nik-U/pbc"
+	"io/fs"
+	"strings"
 	"testing"
 )
 
 var (
-	testSetupKey = NewSetupKey(NewSystemParameters(pbc.GenerateF(160).NewPairing()))
+	testSetupKey = NewSetupKey(NewSystemParametersFromParams(pbc.GenerateF(160)))
 )
 
 func TestBasis(t *testing.T) {
@@ -69,6 +72,422 @@ func TestIdentifier(t *testing.T) {
 	}
 }
 
+func TestSetIdentifier(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	oldIdentifier := "old identifier"
+	newIdentifier := "new identifier"
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	ciphertextsOld := make([]*Ciphertext, len(agents))
+	ciphertextsOld[0] = agents[0].NewCiphertext(oldIdentifier, 16)
+	ciphertextsOld[1] = agents[1].NewCiphertext(oldIdentifier, 42)
+	ciphertextsOld[2] = agents[2].NewCiphertext(oldIdentifier, 12)
+
+	ciphertextsNew := make([]*Ciphertext, len(agents))
+	ciphertextsNew[0] = agents[0].NewCiphertext(newIdentifier, 16)
+	ciphertextsNew[1] = agents[1].NewCiphertext(newIdentifier, 42)
+	ciphertextsNew[2] = agents[2].NewCiphertext(newIdentifier, 12)
+
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, oldIdentifier)
+	if !alarmsystem.Test(ciphertextsOld) {
+		t.Fatal("No alarm was raised for the original identifier.")
+	}
+
+	alarmsystem.SetIdentifier(newIdentifier)
+	if !alarmsystem.Test(ciphertextsNew) {
+		t.Fatal("No alarm was raised for the new identifier.")
+	}
+	if alarmsystem.Test(ciphertextsOld) {
+		t.Fatal("Alarm was raised for ciphertexts of the old identifier.")
+	}
+}
+
+func TestMessageSpaceBits(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 12)
+
+	for i, agent := range agents {
+		if bits := agent.MessageSpaceBits(); bits != 12 {
+			t.Fatalf("Agent %d reports a message space of %d bits, expected 12.", i, bits)
+		}
+	}
+	if bits := rulegenerator.MessageSpaceBits(); bits != 12 {
+		t.Fatalf("Rule generator reports a message space of %d bits, expected 12.", bits)
+	}
+}
+
+func TestVariableMessageSpace(t *testing.T) {
+	rulegenerator, agents, err := testSetupKey.GenerateKeysVariable([]int{1, 16})
+	if err != nil {
+		t.Fatal("Error generating keys: ", err)
+	}
+	if agents[0].MessageSpaceBits() != 1 || agents[1].MessageSpaceBits() != 16 {
+		t.Fatal("Agents do not have the requested message space.")
+	}
+	if rulegenerator.MessageSpaceBits() != 0 {
+		t.Fatal("Rule generator reports a common message space for differing agents.")
+	}
+
+	identifier := "identifier"
+
+	for _, rules := range [][]int32{{0, 0}, {1, 65535}} {
+		ruletoken, err := rulegenerator.NewToken(rules)
+		if err != nil {
+			t.Fatalf("Error creating token for %v: %v", rules, err)
+		}
+		ciphertexts := []*Ciphertext{
+			agents[0].NewCiphertext(identifier, rules[0]),
+			agents[1].NewCiphertext(identifier, rules[1]),
+		}
+		if !NewAlarmSystem(testSetupKey.sp, ruletoken, identifier).Test(ciphertexts) {
+			t.Fatalf("No alarm was raised for %v, whereas an alarm should have been raised.", rules)
+		}
+	}
+
+	for _, rules := range [][]int32{{2, 0}, {0, 65536}} {
+		if _, err := rulegenerator.NewToken(rules); err != ErrRuleValueOutOfRange {
+			t.Fatalf("Expected ErrRuleValueOutOfRange for %v, got %v.", rules, err)
+		}
+	}
+
+	if _, _, err := testSetupKey.GenerateKeysVariable([]int{8, 0}); err != ErrInvalidMessageSpace {
+		t.Fatal("Expected ErrInvalidMessageSpace for an empty message space, got: ", err)
+	}
+}
+
+func TestWildcardToken(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	identifier := "identifier"
+
+	ciphertexts := make([]*Ciphertext, len(agents))
+	ciphertexts[0] = agents[0].NewCiphertext(identifier, 16)
+	ciphertexts[1] = agents[1].NewCiphertext(identifier, 42)
+	ciphertexts[2] = agents[2].NewCiphertext(identifier, 12)
+
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, rulegenerator.NewWildcardToken(), identifier)
+	if !alarmsystem.Test(ciphertexts) {
+		t.Fatal("No alarm was raised for the wildcard token.")
+	}
+
+	// A dense rule consisting of wildcards only is equivalent.
+	ruletoken, err := rulegenerator.NewToken([]int32{Wildcard, Wildcard, Wildcard})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	if !NewAlarmSystem(testSetupKey.sp, ruletoken, identifier).Test(ciphertexts) {
+		t.Fatal("No alarm was raised for an all-wildcard rule.")
+	}
+}
+
+func TestEmptyCiphertexts(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	identifier := "identifier"
+
+	wildcard := NewAlarmSystem(testSetupKey.sp, rulegenerator.NewWildcardToken(), identifier)
+	if !wildcard.Test(nil) || !wildcard.Test([]*Ciphertext{}) {
+		t.Fatal("No alarm was raised for the wildcard token without ciphertexts.")
+	}
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, identifier)
+	if alarmsystem.Test(nil) {
+		t.Fatal("Alarm was raised without ciphertexts.")
+	}
+
+	// The ciphertext of the last pinned agent is missing.
+	short := []*Ciphertext{agents[0].NewCiphertext(identifier, 16)}
+	if alarmsystem.Test(short) {
+		t.Fatal("Alarm was raised with a missing ciphertext.")
+	}
+	withNil := []*Ciphertext{short[0], nil, nil}
+	if alarmsystem.Test(withNil) {
+		t.Fatal("Alarm was raised with a nil ciphertext.")
+	}
+
+	// Wildcard positions do not need a ciphertext.
+	withNil[2] = agents[2].NewCiphertext(identifier, 12)
+	if !alarmsystem.Test(withNil) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+}
+
+func TestSetupKeyFromSeed(t *testing.T) {
+	_, agents1 := NewSetupKeyFromSeed(testSetupKey.sp, []byte("seed")).GenerateKeys(2, 8)
+	_, agents2 := NewSetupKeyFromSeed(testSetupKey.sp, []byte("seed")).GenerateKeys(2, 8)
+	_, agents3 := NewSetupKeyFromSeed(testSetupKey.sp, []byte("other seed")).GenerateKeys(2, 8)
+
+	for i := range agents1 {
+		if !agents1[i].gamma.Equals(agents2[i].gamma) || !agents1[i].g1alpha.Equals(agents2[i].g1alpha) {
+			t.Fatalf("Agent %d differs for the same seed.", i)
+		}
+		for j := range agents1[i].beta {
+			if !agents1[i].beta[j].Equals(agents2[i].beta[j]) {
+				t.Fatalf("Agent %d differs for the same seed.", i)
+			}
+		}
+		if agents1[i].gamma.Equals(agents3[i].gamma) {
+			t.Fatalf("Agent %d is equal for different seeds.", i)
+		}
+	}
+
+	// An empty seed is a seed too, also after encoding the setup key.
+	_, empty1 := NewSetupKeyFromSeed(testSetupKey.sp, []byte{}).GenerateKeys(1, 8)
+	data, err := NewSetupKeyFromSeed(testSetupKey.sp, nil).MarshalBinary()
+	if err != nil {
+		t.Fatal("Error marshaling setup key: ", err)
+	}
+	setupkey, err := testSetupKey.sp.UnmarshalSetupKey(data)
+	if err != nil {
+		t.Fatal("Error unmarshaling setup key: ", err)
+	}
+	_, empty2 := setupkey.GenerateKeys(1, 8)
+	if !empty1[0].gamma.Equals(empty2[0].gamma) {
+		t.Fatal("Agent differs for the empty seed.")
+	}
+}
+
+func TestPRFAux(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(1, 8)
+	agent, info := agents[0], rulegenerator.agents[0]
+	sp := testSetupKey.sp
+
+	for _, x := range []int32{0, 1, 42, 255} {
+		aux := sp.pairing.NewZr().Rand()
+
+		f1 := sp.F(1, agent.g1alpha, agent.beta, aux, x)
+		expected1 := sp.pairing.NewG1().PowZn(sp.evaluatePRF(1, agent.g1alpha, agent.beta, x), aux)
+		if !f1.Equals(expected1) {
+			t.Fatalf("F in group 1 with aux does not equal the PRF to the power aux for %d.", x)
+		}
+
+		f2 := sp.F(2, info.g2alpha, info.beta, aux, x)
+		expected2 := sp.pairing.NewG2().PowZn(sp.evaluatePRF(2, info.g2alpha, info.beta, x), aux)
+		if !f2.Equals(expected2) {
+			t.Fatalf("F in group 2 with aux does not equal the PRF to the power aux for %d.", x)
+		}
+	}
+
+	one := sp.pairing.NewZr().Set1()
+	if !sp.F(1, agent.g1alpha, agent.beta, one, 42).Equals(sp.evaluatePRF(1, agent.g1alpha, agent.beta, 42)) {
+		t.Fatal("F with aux = 1 does not equal the PRF.")
+	}
+}
+
+func TestEstimateSetup(t *testing.T) {
+	n, bits := 4, 8
+	rulegenerator, agents := testSetupKey.GenerateKeys(n, bits)
+
+	// Count the distinct elements held by the agents and the rule generator.
+	seen := make(map[*pbc.Element]bool)
+	var size int64
+	count := func(elements ...*pbc.Element) {
+		for _, el := range elements {
+			if !seen[el] {
+				seen[el] = true
+				size += int64(len(el.Bytes()))
+			}
+		}
+	}
+	for i, agent := range agents {
+		count(agent.g1alpha, agent.gamma)
+		count(agent.beta...)
+		info := rulegenerator.agents[i]
+		count(info.g2alpha, info.g2gamma)
+		count(info.beta...)
+	}
+
+	bytes, elements := testSetupKey.sp.EstimateSetup(n, bits)
+	if elements != len(seen) {
+		t.Fatalf("Estimated %d elements, but %d were generated.", elements, len(seen))
+	}
+	if bytes != size {
+		t.Fatalf("Estimated %d bytes, but %d were generated.", bytes, size)
+	}
+}
+
+func TestSystemParametersFromParamFile(t *testing.T) {
+	sp, err := NewSystemParametersFromParamFile("testdata/a.param")
+	if err != nil {
+		t.Fatal("Error loading parameters: ", err)
+	}
+
+	rulegenerator, agents := NewSetupKey(sp).GenerateKeys(2, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 12),
+	}
+	if !NewAlarmSystem(sp, ruletoken, "identifier").Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+
+	if _, err := NewSystemParametersFromParamFile("testdata/missing.param"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("Expected a not-exist error for a missing file, got: ", err)
+	}
+	if _, err := NewSystemParametersFromParamFile("testdata/invalid.param"); !errors.Is(err, ErrInvalidParams) {
+		t.Fatal("Expected ErrInvalidParams for an invalid file, got: ", err)
+	}
+}
+
+func TestRuleGeneratorAgents(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	if n := rulegenerator.NumAgents(); n != 3 {
+		t.Fatalf("Rule generator knows %d agents, expected 3.", n)
+	}
+
+	var infos []AgentInfo
+	for i, info := range rulegenerator.Agents() {
+		if i != len(infos) {
+			t.Fatalf("Got agent %d at position %d.", i, len(infos))
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("Iterated over %d agents, expected 3.", len(infos))
+	}
+
+	reconstructed := NewRuleGenerator(testSetupKey.sp, infos)
+	ruletoken, err := reconstructed.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	identifier := "identifier"
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext(identifier, 16),
+		agents[1].NewCiphertext(identifier, 42),
+		agents[2].NewCiphertext(identifier, 12),
+	}
+	if !NewAlarmSystem(testSetupKey.sp, ruletoken, identifier).Test(ciphertexts) {
+		t.Fatal("No alarm was raised for a token of the reconstructed rule generator.")
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	sp := testSetupKey.sp
+
+	same := &SystemParameters{g1: sp.g1, g2: sp.g2, pairing: sp.pairing}
+	if err := sp.Compatible(same); err != nil {
+		t.Fatal("System parameters with the same generators are incompatible: ", err)
+	}
+
+	// Both generators differ, the first difference is reported.
+	other := NewSystemParameters(sp.pairing)
+	err := sp.Compatible(other)
+	if !errors.Is(err, ErrIncompatibleParameters) || !strings.Contains(err.Error(), "g1") {
+		t.Fatal("Expected an error naming generator g1, got: ", err)
+	}
+
+	otherG2 := &SystemParameters{g1: sp.g1, g2: other.g2, pairing: sp.pairing}
+	err = sp.Compatible(otherG2)
+	if !errors.Is(err, ErrIncompatibleParameters) || !strings.Contains(err.Error(), "g2") {
+		t.Fatal("Expected an error naming generator g2, got: ", err)
+	}
+}
+
+func TestTokenFromMap(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(10, 8)
+
+	identifier := "identifier"
+
+	ruletoken, err := rulegenerator.NewTokenFromMap(map[int]int32{3: 16, 7: 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	if covered, _ := ruletoken.Coverage(); len(covered) != 2 || covered[0] != 3 || covered[1] != 7 {
+		t.Fatalf("Token covers %v, expected [3 7].", covered)
+	}
+
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, agent := range agents {
+		ciphertexts[i] = agent.NewCiphertext(identifier, int32(i))
+	}
+	ciphertexts[3] = agents[3].NewCiphertext(identifier, 16)
+	ciphertexts[7] = agents[7].NewCiphertext(identifier, 12)
+
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, identifier)
+	if !alarmsystem.Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+	ciphertexts[7] = agents[7].NewCiphertext(identifier, 16)
+	if alarmsystem.Test(ciphertexts) {
+		t.Fatal("Alarm was raised whereas it should not have.")
+	}
+
+	for _, index := range []int{-1, 10} {
+		if _, err := rulegenerator.NewTokenFromMap(map[int]int32{index: 1}); err != ErrInvalidAgentIndex {
+			t.Fatalf("Expected ErrInvalidAgentIndex for index %d, got: %v", index, err)
+		}
+	}
+}
+
+func TestMaxMessage(t *testing.T) {
+	for _, c := range []struct {
+		bits int
+		max  int64
+	}{
+		{0, 0},
+		{1, 1},
+		{8, 255},
+		{31, 2147483647},
+		{63, 9223372036854775807},
+	} {
+		if max := MaxMessage(c.bits); max != c.max {
+			t.Fatalf("MaxMessage(%d) = %d, expected %d.", c.bits, max, c.max)
+		}
+	}
+
+	identifier := "identifier"
+	rulegenerator, agents, err := testSetupKey.GenerateKeysVariable([]int{8, 16, 31})
+	if err != nil {
+		t.Fatal("Error generating keys: ", err)
+	}
+
+	// The largest message of each agent sets its highest bit.
+	rules := []int32{int32(MaxMessage(8)), int32(MaxMessage(16)), int32(MaxMessage(31))}
+	ruletoken, err := rulegenerator.NewToken(rules)
+	if err != nil {
+		t.Fatal("Error creating token for the largest messages: ", err)
+	}
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, agent := range agents {
+		ciphertexts[i] = agent.NewCiphertext(identifier, rules[i])
+	}
+	if !NewAlarmSystem(testSetupKey.sp, ruletoken, identifier).Test(ciphertexts) {
+		t.Fatal("No alarm was raised for the largest messages.")
+	}
+
+	// MaxMessage(31) + 1 does not fit in an int32, so only the smaller message
+	// spaces can be exceeded.
+	for i, v := range []int32{int32(MaxMessage(8)) + 1, int32(MaxMessage(16)) + 1} {
+		rules := []int32{Wildcard, Wildcard, Wildcard}
+		rules[i] = v
+		if _, err := rulegenerator.NewToken(rules); err != ErrRuleValueOutOfRange {
+			t.Fatalf("Expected ErrRuleValueOutOfRange for %d, got: %v", v, err)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != ErrPlaintextOutOfRange {
+			t.Fatal("Expected a panic with ErrPlaintextOutOfRange, got: ", r)
+		}
+	}()
+	agents[0].NewCiphertext(identifier, int32(MaxMessage(8))+1)
+}
+
 func benchmarkEncryption(b *testing.B, messageSpaceBitSize int) {
 	_, agents := testSetupKey.GenerateKeys(1, messageSpaceBitSize)
 	agent := agents[0]
@@ -83,6 +502,18 @@ func benchmarkEncryption(b *testing.B, messageSpaceBitSize int) {
 	}
 }
 
+func BenchmarkEncryptionInto8Bits(b *testing.B) {
+	_, agents := testSetupKey.GenerateKeys(1, 8)
+	agent := agents[0]
+	ct := new(Ciphertext)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		agent.NewCiphertextInto(ct, "identifier", 255)
+	}
+}
+
 func BenchmarkEncryption8Bits(b *testing.B) {
 	benchmarkEncryption(b, 8)
 }
@@ -95,6 +526,29 @@ func BenchmarkEncryption32Bits(b *testing.B) {
 	benchmarkEncryption(b, 32)
 }
 
+// BenchmarkGeneratorPowZn measures the exponentiation of g1 as done by
+// NewCiphertext without the preprocessed generator.
+func BenchmarkGeneratorPowZn(b *testing.B) {
+	sp := testSetupKey.sp
+	r := sp.pairing.NewZr().Rand()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp.pairing.NewG1().PowZn(sp.g1, r)
+	}
+}
+
+// BenchmarkGeneratorPowerZn measures the exponentiation of g1 as done by
+// NewCiphertext with the preprocessed generator.
+func BenchmarkGeneratorPowerZn(b *testing.B) {
+	sp := testSetupKey.sp
+	r := sp.pairing.NewZr().Rand()
+	g1pp, _ := sp.generatorPowers()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp.pairing.NewG1().PowerZn(g1pp, r)
+	}
+}
+
 func benchmarkTest(b *testing.B, numAgents int) {
 	rulegenerator, agents := testSetupKey.GenerateKeys(numAgents, 8)
 
@@ -132,3 +586,228 @@ func BenchmarkTest10Agents(b *testing.B) {
 func BenchmarkTest100Agents(b *testing.B) {
 	benchmarkTest(b, 100)
 }
+
+func TestHashedGenerators(t *testing.T) {
+	newSystem := func() *SystemParameters {
+		params, err := pbc.NewParamsFromString(testSetupKey.sp.params)
+		if err != nil {
+			t.Fatal("Error parsing parameters: ", err)
+		}
+		return NewSystemParametersFromParams(params, WithHashedGenerators("seed"))
+	}
+	sp, otherSp := newSystem(), newSystem()
+	if err := sp.Compatible(otherSp); err != nil {
+		t.Fatal("Systems with the same seed are incompatible: ", err)
+	}
+	if NewSystemParameters(sp.pairing, WithHashedGenerators("other seed")).Compatible(sp) == nil {
+		t.Fatal("Systems with different seeds are compatible.")
+	}
+
+	// Keys are generated in one system, the agents encrypt in the other.
+	rulegenerator, agents := NewSetupKey(sp).GenerateKeys(3, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, v := range []int32{16, 42, 12} {
+		data, err := agents[i].MarshalBinary()
+		if err != nil {
+			t.Fatal("Error marshaling agent: ", err)
+		}
+		agent, err := otherSp.UnmarshalAgent(data)
+		if err != nil {
+			t.Fatal("Error unmarshaling agent: ", err)
+		}
+		if data, err = agent.NewCiphertext("identifier", v).MarshalBinary(); err != nil {
+			t.Fatal("Error marshaling ciphertext: ", err)
+		}
+		if ciphertexts[i], err = sp.UnmarshalCiphertext(data); err != nil {
+			t.Fatal("Error unmarshaling ciphertext: ", err)
+		}
+	}
+	if !NewAlarmSystem(sp, ruletoken, "identifier").Test(ciphertexts) {
+		t.Fatal("Ciphertexts of the other system did not match the token.")
+	}
+}
+
+func TestConstantTimeCompare(t *testing.T) {
+	sp := NewSystemParameters(testSetupKey.sp.pairing, WithConstantTimeCompare())
+
+	for i := 0; i < 100; i++ {
+		x := sp.pairing.NewGT().Rand()
+		y := sp.pairing.NewGT().Set(x)
+		if !sp.equal(x, y) || !x.Equals(y) {
+			t.Fatal("Equal elements compared unequal.")
+		}
+		y.Rand()
+		if sp.equal(x, y) != x.Equals(y) {
+			t.Fatal("Constant-time comparison differs from Equals.")
+		}
+	}
+
+	rulegenerator, agents := NewSetupKey(sp).GenerateKeys(3, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	alarmsystem := NewAlarmSystem(sp, ruletoken, "identifier")
+	for _, v := range []int32{12, 13} {
+		ciphertexts := []*Ciphertext{
+			agents[0].NewCiphertext("identifier", 16),
+			agents[1].NewCiphertext("identifier", 42),
+			agents[2].NewCiphertext("identifier", v),
+		}
+		if alarmsystem.Test(ciphertexts) != (v == 12) {
+			t.Fatalf("Unexpected result for plaintext %d.", v)
+		}
+	}
+}
+
+func TestElementSizes(t *testing.T) {
+	sp, err := NewSystemParametersFromParamFile("testdata/a.param")
+	if err != nil {
+		t.Fatal("Error reading parameter file: ", err)
+	}
+	_, agents := NewSetupKey(sp).GenerateKeys(1, 8)
+	ct := agents[0].NewCiphertext("identifier", 16)
+
+	sizes := []struct {
+		name          string
+		got, expected int
+	}{
+		{"G1", sp.G1Bytes(), len(ct.part1.Bytes())},
+		{"G2", sp.G2Bytes(), len(sp.g2.Bytes())},
+		{"GT", sp.GTBytes(), len(sp.pairing.NewGT().Pair(sp.g1, sp.g2).Bytes())},
+		{"Zr", sp.ZrBytes(), len(agents[0].gamma.Bytes())},
+	}
+	for _, size := range sizes {
+		if size.got != size.expected {
+			t.Fatalf("%s elements have %d bytes, reported %d.", size.name, size.expected, size.got)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	sp := NewSystemParameters(testSetupKey.sp.pairing)
+	rulegenerator, agents := NewSetupKey(sp).GenerateKeys(2, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 12),
+	}
+	alarmsystem := NewAlarmSystem(sp, ruletoken, "identifier")
+
+	if err := sp.Close(); err != nil {
+		t.Fatal("Error closing system parameters: ", err)
+	}
+	if err := sp.Close(); err != ErrClosed {
+		t.Fatal("Expected ErrClosed when closing twice, got: ", err)
+	}
+	if _, err := rulegenerator.NewToken([]int32{16, 12}); err != ErrClosed {
+		t.Fatal("Expected ErrClosed when creating a token, got: ", err)
+	}
+	if _, err := alarmsystem.TestChecked(ciphertexts); err != ErrClosed {
+		t.Fatal("Expected ErrClosed when testing, got: ", err)
+	}
+	if _, _, err := NewSetupKey(sp).GenerateKeysVariable([]int{8}); err != ErrClosed {
+		t.Fatal("Expected ErrClosed when generating keys, got: ", err)
+	}
+
+	defer func() {
+		if r := recover(); r != ErrClosed {
+			t.Fatal("Expected a panic with ErrClosed when encrypting, got: ", r)
+		}
+	}()
+	agents[0].NewCiphertext("identifier", 16)
+}
+
+func TestNewCiphertextInto(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{new(Ciphertext), new(Ciphertext)}
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, "identifier")
+	for _, v := range []int32{12, 13, 12} {
+		if err := agents[0].NewCiphertextInto(ciphertexts[0], "identifier", 16); err != nil {
+			t.Fatal("Error encrypting: ", err)
+		}
+		if err := agents[1].NewCiphertextInto(ciphertexts[1], "identifier", v); err != nil {
+			t.Fatal("Error encrypting: ", err)
+		}
+		if alarmsystem.Test(ciphertexts) != (v == 12) {
+			t.Fatalf("Unexpected result for reused ciphertexts of value %d.", v)
+		}
+	}
+	if err := agents[0].NewCiphertextInto(ciphertexts[0], "identifier", 256); err != ErrPlaintextOutOfRange {
+		t.Fatal("Expected ErrPlaintextOutOfRange, got: ", err)
+	}
+
+	allocs := testing.AllocsPerRun(20, func() {
+		agents[0].NewCiphertext("identifier", 255)
+	})
+	allocsInto := testing.AllocsPerRun(20, func() {
+		agents[0].NewCiphertextInto(ciphertexts[0], "identifier", 255)
+	})
+	t.Logf("NewCiphertext: %v allocs, NewCiphertextInto: %v allocs.", allocs, allocsInto)
+	if allocsInto > allocs/2 {
+		t.Fatalf("NewCiphertextInto allocates %v times, NewCiphertext %v times.", allocsInto, allocs)
+	}
+}
+
+func TestTokenStrict(t *testing.T) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(3, 8)
+
+	if _, err := rulegenerator.NewTokenStrict([]int32{-1, Wildcard, -7}); err != ErrNoConstraints {
+		t.Fatal("Expected ErrNoConstraints for an all-wildcard rule, got: ", err)
+	}
+	if _, err := rulegenerator.NewToken([]int32{-1, Wildcard, -7}); err != nil {
+		t.Fatal("Error creating all-wildcard token: ", err)
+	}
+	if _, err := rulegenerator.NewTokenStrict([]int32{-1, -1}); err != ErrWrongNumberOfRules {
+		t.Fatal("Expected ErrWrongNumberOfRules, got: ", err)
+	}
+	if _, err := rulegenerator.NewTokenStrict([]int32{-1, 0, -1}); err != nil {
+		t.Fatal("Error creating strict token: ", err)
+	}
+}
+
+func TestRevoked(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 12),
+	}
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, "identifier")
+
+	// Revoking an agent the token does not constrain changes nothing.
+	alarmsystem.SetRevoked(1)
+	if !alarmsystem.Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+
+	alarmsystem.SetRevoked(1, 2)
+	if alarmsystem.Test(ciphertexts) {
+		t.Fatal("Token constraining a revoked agent matched.")
+	}
+	if _, err := alarmsystem.TestChecked(ciphertexts); !errors.Is(err, ErrRevokedAgent) {
+		t.Fatal("Expected ErrRevokedAgent, got: ", err)
+	} else {
+		t.Log("Test failed, as expected: ", err)
+	}
+
+	alarmsystem.SetRevoked()
+	if !alarmsystem.Test(ciphertexts) {
+		t.Fatal("No alarm was raised after clearing the revoked agents.")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+// Package crypmonsystest provides helpers for testing code that uses the
+// crypmonsys package. It is kept in a separate package so production binaries
+// do not pull in test-only code.
+package crypmonsystest
+
+import (
+	"crypmonsys"
+	"github.com/Nik-U/pbc"
+	"sync"
+	"testing"
+)
+
+// testParams are the parameters of a small Type F (BN) curve, so every test
+// system uses the same pairing.
+const testParams = `type f
+q 205523667896953300194896352429254920972540065223
+r 205523667896953300194895899082072403858390252929
+b 40218105156867728698573668525883168222119515413
+beta 115334401956802802075595682801335644058796914268
+alpha0 191079354656274778837764015557338301375963168470
+alpha1 71445317903696340296199556072836940741717506375
+`
+
+var (
+	pairingOnce sync.Once
+	pairing     *pbc.Pairing
+	pairingErr  error
+)
+
+// NewTestSystem sets up a system with n agents that each have a message space
+// of bits bits. The curve is fixed and the key material is derived from the
+// name of the test, so a test gets the same keys on every run. The generators
+// are derived from a fixed seed, so all test systems share them. Setup
+// failures are reported on t.
+func NewTestSystem(t testing.TB, n, bits int) (*crypmonsys.SystemParameters, *crypmonsys.RuleGenerator, []*crypmonsys.Agent) {
+	t.Helper()
+	pairingOnce.Do(func() {
+		pairing, pairingErr = pbc.NewPairingFromString(testParams)
+	})
+	if pairingErr != nil {
+		t.Fatal("Error creating pairing: ", pairingErr)
+	}
+	if n < 1 || bits < 1 {
+		t.Fatalf("Invalid test system: %d agents with %d bits.", n, bits)
+	}
+
+	sp := crypmonsys.NewSystemParameters(pairing, crypmonsys.WithHashedGenerators("crypmonsystest"))
+	rulegenerator, agents := crypmonsys.NewSetupKeyFromSeed(sp, []byte(t.Name())).GenerateKeys(n, bits)
+	return sp, rulegenerator, agents
+}
@@ -0,0 +1,29 @@
+package crypmonsystest
+
+import (
+	"crypmonsys"
+	"testing"
+)
+
+func TestNewTestSystem(t *testing.T) {
+	sp, rulegenerator, agents := NewTestSystem(t, 3, 8)
+	if len(agents) != 3 {
+		t.Fatalf("Got %d agents, expected 3.", len(agents))
+	}
+
+	identifier := "identifier"
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, crypmonsys.Wildcard, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	ciphertexts := []*crypmonsys.Ciphertext{
+		agents[0].NewCiphertext(identifier, 16),
+		agents[1].NewCiphertext(identifier, 42),
+		agents[2].NewCiphertext(identifier, 12),
+	}
+	if !crypmonsys.NewAlarmSystem(sp, ruletoken, identifier).Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+}
@@ -0,0 +1,740 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Nik-U/pbc"
+)
+
+var (
+	// ErrInvalidElement is an error that is issued when bytes do not encode a
+	// valid element of the expected group.
+	ErrInvalidElement = errors.New("Bytes do not encode a valid group element.")
+
+	// ErrInvalidAgentIndex is an error that is issued when an agent index is
+	// out of range.
+	ErrInvalidAgentIndex = errors.New("Agent index is out of range.")
+
+	// ErrMalformedData is an error that is issued when serialized data cannot
+	// be decoded.
+	ErrMalformedData = errors.New("Serialized data is malformed.")
+
+	// ErrUnknownParams is an error that is issued when system parameters are
+	// serialized whose pairing parameters are not known. Use
+	// NewSystemParametersFromParams to create serializable system parameters.
+	ErrUnknownParams = errors.New("Pairing parameters of the system parameters are unknown.")
+
+	// ErrTooManyComponents is an error that is issued when serialized data
+	// claims more agents than the decoder accepts.
+	ErrTooManyComponents = errors.New("Serialized data has too many components.")
+)
+
+// DefaultMaxAgents is the largest number of agents accepted when decoding rule
+// tokens and rule generators, unless WithMaxAgents sets another limit.
+const DefaultMaxAgents = 1 << 16
+
+// Every serialized object starts with a tag identifying its type, followed by
+// the version of the encoding. Integers are encoded as unsigned varints and
+// group elements by their fixed-length Bytes encoding.
+const (
+	tagSystemParameters = 'P'
+	tagSetupKey         = 'S'
+	tagAgent            = 'A'
+	tagRuleGenerator    = 'R'
+	tagCiphertext       = 'C'
+	tagAgentInfo        = 'I'
+	tagRuleToken        = 'T'
+	tagCiphertextBatch  = 'B'
+	tagCompositeToken   = 'M'
+
+	encodingVersion = 1
+)
+
+// DecodeOption configures how serialized data is decoded.
+type DecodeOption func(*decodeOptions)
+
+// decodeOptions holds the configuration set by DecodeOptions.
+type decodeOptions struct {
+	skipGroupCheck bool
+	maxAgents      int
+}
+
+// newDecodeOptions applies opts to the default configuration.
+func newDecodeOptions(opts []DecodeOption) decodeOptions {
+	o := decodeOptions{maxAgents: DefaultMaxAgents}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// SkipGroupCheck disables the check that decoded group elements are in the
+// subgroup of prime order, which costs an exponentiation per element. The
+// encoding of the elements is still checked. Only use this option for input
+// from a trusted source.
+func SkipGroupCheck() DecodeOption {
+	return func(o *decodeOptions) {
+		o.skipGroupCheck = true
+	}
+}
+
+// WithMaxAgents limits the number of agents accepted when decoding rule tokens
+// and rule generators to n. Data claiming more agents is rejected with
+// ErrTooManyComponents before anything is allocated for them. When the number
+// of agents of the system is known, pass it here, e.g. the NumAgents of the
+// rule generator.
+func WithMaxAgents(n int) DecodeOption {
+	return func(o *decodeOptions) {
+		o.maxAgents = n
+	}
+}
+
+// MakeCiphertext assembles a ciphertext of the agent with the given index from
+// the bytes of its two parts, as returned by the Bytes method of the G1
+// elements. Both parts are checked to be valid members of G1, unless
+// SkipGroupCheck is passed. This allows ciphertexts generated outside of this
+// package to be tested.
+func (sp *SystemParameters) MakeCiphertext(index int, part1, part2 []byte, opts ...DecodeOption) (*Ciphertext, error) {
+	ct, err := sp.makeCiphertext(index, part1, part2, newDecodeOptions(opts))
+	if err != nil {
+		sp.logDecodeRejected(err)
+		return nil, err
+	}
+	return ct, nil
+}
+
+// makeCiphertext implements MakeCiphertext.
+func (sp *SystemParameters) makeCiphertext(index int, part1, part2 []byte, o decodeOptions) (*Ciphertext, error) {
+	if index < 0 {
+		return nil, ErrInvalidAgentIndex
+	}
+	ct := &Ciphertext{
+		index: index,
+		part1: sp.pairing.NewG1(),
+		part2: sp.pairing.NewG1(),
+	}
+	if err := sp.decodeElement(ct.part1, part1, !o.skipGroupCheck); err != nil {
+		return nil, err
+	}
+	if err := sp.decodeElement(ct.part2, part2, !o.skipGroupCheck); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// decodeElement sets el to the element encoded in data. The encoding must be
+// canonical and, if checkGroup is set, el must be in the subgroup of order r.
+func (sp *SystemParameters) decodeElement(el *pbc.Element, data []byte, checkGroup bool) error {
+	// pbc reads as many bytes as the element needs, regardless of the length
+	// of data.
+	if len(data) != el.BytesLen() {
+		return ErrInvalidElement
+	}
+	el.SetBytes(data)
+	if !bytes.Equal(el.Bytes(), data) {
+		return ErrInvalidElement
+	}
+	if checkGroup {
+		// r itself cannot be represented in Zr, so check el^r = 1 as
+		// el^(r-1) * el = 1.
+		minusOne := sp.pairing.NewZr().Set1().ThenNeg()
+		if !el.NewFieldElement().PowZn(el, minusOne).ThenMul(el).Is1() {
+			return ErrInvalidElement
+		}
+	}
+	return nil
+}
+
+// encoder appends the encoding of values to a buffer.
+type encoder struct {
+	buf []byte
+}
+
+// header writes the tag and the encoding version.
+func (e *encoder) header(tag byte) {
+	e.buf = append(e.buf, tag, encodingVersion)
+}
+
+// uvarint writes v as an unsigned varint.
+func (e *encoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+// bytes writes b prefixed with its length.
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// elements writes the fixed-length encodings of the elements.
+func (e *encoder) elements(elements ...*pbc.Element) {
+	for _, el := range elements {
+		e.buf = append(e.buf, el.Bytes()...)
+	}
+}
+
+// decoder reads values from serialized data. After the first error all reads
+// return zero values, so the error only has to be checked at the end.
+type decoder struct {
+	sp   *SystemParameters
+	data []byte
+	opts decodeOptions
+	err  error
+}
+
+// newDecoder returns a decoder for data using the pairing of sp.
+func (sp *SystemParameters) newDecoder(data []byte, opts []DecodeOption) *decoder {
+	return &decoder{sp: sp, data: data, opts: newDecodeOptions(opts)}
+}
+
+// fail records err as the error of the decoder, unless it already failed.
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+		d.data = nil
+		d.sp.logDecodeRejected(err)
+	}
+}
+
+// header reads the tag and the encoding version and checks them.
+func (d *decoder) header(tag byte) {
+	if len(d.data) < 2 || d.data[0] != tag || d.data[1] != encodingVersion {
+		d.fail(ErrMalformedData)
+		return
+	}
+	d.data = d.data[2:]
+}
+
+// uvarint reads an unsigned varint. Only the shortest encoding of a value is
+// accepted, so every value has a single encoding.
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 || (n > 1 && d.data[n-1] == 0) {
+		d.fail(ErrMalformedData)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// int reads an unsigned varint that should fit in a non-negative int.
+func (d *decoder) int() int {
+	v := d.uvarint()
+	if v > uint64(maxInt) {
+		d.fail(ErrMalformedData)
+		return 0
+	}
+	return int(v)
+}
+
+// maxInt is the largest value of an int.
+const maxInt = int(^uint(0) >> 1)
+
+// bytes reads a length-prefixed byte slice.
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail(ErrMalformedData)
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// count reads the number of items that follow, each of which takes at least
+// size bytes. The count is checked against the remaining data before anything
+// is allocated for the items.
+func (d *decoder) count(size int) int {
+	n := d.uvarint()
+	if size > 0 && n > uint64(len(d.data)/size) {
+		d.fail(ErrMalformedData)
+		return 0
+	}
+	return int(n)
+}
+
+// agentCount reads the number of per-agent items that follow, each of which
+// takes at least size bytes. The count is checked against the maximum number
+// of agents before it is checked against the remaining data.
+func (d *decoder) agentCount(size int) int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(d.opts.maxAgents) {
+		d.fail(ErrTooManyComponents)
+		return 0
+	}
+	if size > 0 && n > uint64(len(d.data)/size) {
+		d.fail(ErrMalformedData)
+		return 0
+	}
+	return int(n)
+}
+
+// element reads el and checks its encoding. Elements of G1 and G2 are also
+// checked to be in the subgroup of prime order, unless the decode options
+// disable this.
+func (d *decoder) element(el *pbc.Element, isGroup bool) *pbc.Element {
+	if d.err != nil {
+		return el
+	}
+	n := el.BytesLen()
+	if n > len(d.data) {
+		d.fail(ErrMalformedData)
+		return el
+	}
+	if err := d.sp.decodeElement(el, d.data[:n], isGroup && !d.opts.skipGroupCheck); err != nil {
+		d.fail(err)
+		return el
+	}
+	d.data = d.data[n:]
+	return el
+}
+
+// g1, g2 and zr read an element of the respective group.
+func (d *decoder) g1() *pbc.Element { return d.element(d.sp.pairing.NewG1(), true) }
+func (d *decoder) g2() *pbc.Element { return d.element(d.sp.pairing.NewG2(), true) }
+func (d *decoder) zr() *pbc.Element { return d.element(d.sp.pairing.NewZr(), false) }
+
+// finish returns the error of the decoder, or ErrMalformedData if not all
+// data was read.
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) != 0 {
+		d.fail(ErrMalformedData)
+	}
+	return d.err
+}
+
+// MarshalBinary encodes the system parameters: the pairing parameters and the
+// generators. It returns ErrUnknownParams if the pairing parameters were not
+// recorded when the system parameters were created.
+func (sp *SystemParameters) MarshalBinary() ([]byte, error) {
+	if err := sp.checkOpen(); err != nil {
+		return nil, err
+	}
+	if sp.params == "" {
+		return nil, ErrUnknownParams
+	}
+	var e encoder
+	e.header(tagSystemParameters)
+	e.bytes([]byte(sp.params))
+	e.elements(sp.g1, sp.g2)
+	return e.buf, nil
+}
+
+// UnmarshalSystemParameters decodes system parameters encoded by
+// MarshalBinary.
+func UnmarshalSystemParameters(data []byte, opts ...DecodeOption) (*SystemParameters, error) {
+	if len(data) < 2 || data[0] != tagSystemParameters || data[1] != encodingVersion {
+		return nil, ErrMalformedData
+	}
+	params, n := binary.Uvarint(data[2:])
+	if n <= 0 || params > uint64(len(data)-2-n) {
+		return nil, ErrMalformedData
+	}
+	paramString := string(data[2+n : 2+n+int(params)])
+	pbcParams, err := pbc.NewParamsFromString(paramString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	sp := &SystemParameters{pairing: pbcParams.NewPairing(), params: pbcParams.String()}
+
+	d := sp.newDecoder(data[2+n+int(params):], opts)
+	sp.g1 = d.g1()
+	sp.g2 = d.g2()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// MarshalBinary encodes the setup key. The system parameters are not part of
+// the encoding. A setup key created with NewSetupKeyFromSeed includes its seed.
+func (sk *SetupKey) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.header(tagSetupKey)
+	if sk.seeded {
+		e.uvarint(1)
+	} else {
+		e.uvarint(0)
+	}
+	e.bytes(sk.seed)
+	e.uvarint(sk.counter)
+	return e.buf, nil
+}
+
+// UnmarshalSetupKey decodes a setup key encoded by MarshalBinary.
+func (sp *SystemParameters) UnmarshalSetupKey(data []byte) (*SetupKey, error) {
+	d := sp.newDecoder(data, nil)
+	d.header(tagSetupKey)
+	seeded := d.uvarint()
+	seed := d.bytes()
+	counter := d.uvarint()
+	if seeded > 1 {
+		d.fail(ErrMalformedData)
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	sk := NewSetupKey(sp)
+	if seeded == 1 {
+		sk.seeded = true
+		sk.seed = append([]byte(nil), seed...)
+		sk.counter = counter
+	}
+	return sk, nil
+}
+
+// MarshalBinary encodes the keys of the agent. The encoding contains the
+// secret keys of the agent.
+func (a *Agent) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.header(tagAgent)
+	e.uvarint(uint64(a.index))
+	e.elements(a.g1alpha)
+	e.uvarint(uint64(len(a.beta)))
+	e.elements(a.beta...)
+	e.elements(a.gamma)
+	return e.buf, nil
+}
+
+// UnmarshalAgent decodes an agent encoded by MarshalBinary.
+func (sp *SystemParameters) UnmarshalAgent(data []byte, opts ...DecodeOption) (*Agent, error) {
+	d := sp.newDecoder(data, opts)
+	d.header(tagAgent)
+	a := &Agent{sp: sp}
+	a.index = d.int()
+	a.g1alpha = d.g1()
+	a.beta = d.zrs()
+	a.gamma = d.zr()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// zrs reads a slice of elements of Zr prefixed with its length.
+func (d *decoder) zrs() []*pbc.Element {
+	n := d.count(d.sp.ZrBytes())
+	if d.err != nil {
+		return nil
+	}
+	elements := make([]*pbc.Element, n)
+	for i := range elements {
+		elements[i] = d.zr()
+	}
+	return elements
+}
+
+// agentInfo writes the information of an agent.
+func (e *encoder) agentInfo(info AgentInfo) {
+	e.elements(info.g2alpha)
+	e.uvarint(uint64(len(info.beta)))
+	e.elements(info.beta...)
+	e.elements(info.g2gamma)
+}
+
+// agentInfo reads the information of an agent.
+func (d *decoder) agentInfo() AgentInfo {
+	var info AgentInfo
+	info.g2alpha = d.g2()
+	info.beta = d.zrs()
+	info.g2gamma = d.g2()
+	return info
+}
+
+// Marshal encodes the information of the agent, so a rule generator can be
+// reconstructed elsewhere with UnmarshalAgentInfo and NewRuleGenerator. The
+// beta keys in the information are the same secret keys the agent encrypts
+// with, so the encoding is as sensitive as the keys of the agent itself.
+func (info AgentInfo) Marshal() ([]byte, error) {
+	var e encoder
+	e.header(tagAgentInfo)
+	e.agentInfo(info)
+	return e.buf, nil
+}
+
+// UnmarshalAgentInfo decodes the information of an agent encoded by Marshal.
+func (sp *SystemParameters) UnmarshalAgentInfo(data []byte, opts ...DecodeOption) (AgentInfo, error) {
+	d := sp.newDecoder(data, opts)
+	d.header(tagAgentInfo)
+	info := d.agentInfo()
+	if err := d.finish(); err != nil {
+		return AgentInfo{}, err
+	}
+	return info, nil
+}
+
+// MarshalBinary encodes the information of all agents known to the rule
+// generator. The encoding contains the beta keys of the agents, which are the
+// secret keys the agents encrypt with. Anyone holding it can create tokens and
+// test arbitrary values, so it must be protected like the keys of the agents.
+// The names of the agents follow, in ascending order.
+func (rg *RuleGenerator) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.header(tagRuleGenerator)
+	e.uvarint(uint64(len(rg.agents)))
+	for _, info := range rg.agents {
+		e.agentInfo(info)
+	}
+	names := rg.AgentNames()
+	e.uvarint(uint64(len(names)))
+	for _, name := range names {
+		e.bytes([]byte(name))
+		e.uvarint(uint64(rg.names[name]))
+	}
+	return e.buf, nil
+}
+
+// UnmarshalRuleGenerator decodes a rule generator encoded by MarshalBinary.
+// The number of agents is limited by WithMaxAgents.
+func (sp *SystemParameters) UnmarshalRuleGenerator(data []byte, opts ...DecodeOption) (*RuleGenerator, error) {
+	d := sp.newDecoder(data, opts)
+	d.header(tagRuleGenerator)
+	// Every agent takes at least two elements of G2.
+	n := d.agentCount(2 * sp.G2Bytes())
+	if d.err != nil {
+		return nil, d.err
+	}
+	agents := make([]AgentInfo, n)
+	for i := range agents {
+		agents[i] = d.agentInfo()
+	}
+	rg := NewRuleGenerator(sp, agents)
+	// Every name takes its length and an index. Names must be in ascending
+	// order, so every set of names has a single encoding.
+	previous := ""
+	for i, count := 0, d.count(2); i < count && d.err == nil; i++ {
+		name := string(d.bytes())
+		index := d.int()
+		if d.err == nil && ((i > 0 && name <= previous) || rg.SetAgentName(index, name) != nil) {
+			d.fail(ErrMalformedData)
+		}
+		previous = name
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return rg, nil
+}
+
+// MarshalBinary encodes the ciphertext. The encoding starts with the index of
+// the agent, so it can be read with PeekCiphertextIndex without decoding the
+// ciphertext.
+func (ct *Ciphertext) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.header(tagCiphertext)
+	e.uvarint(uint64(ct.index))
+	e.elements(ct.part1, ct.part2)
+	return e.buf, nil
+}
+
+// UnmarshalCiphertext decodes a ciphertext encoded by MarshalBinary. Both
+// parts are checked to be valid members of G1, unless SkipGroupCheck is
+// passed.
+func (sp *SystemParameters) UnmarshalCiphertext(data []byte, opts ...DecodeOption) (*Ciphertext, error) {
+	d := sp.newDecoder(data, opts)
+	d.header(tagCiphertext)
+	ct := &Ciphertext{index: d.int()}
+	ct.part1 = d.g1()
+	ct.part2 = d.g1()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// PeekCiphertextIndex returns the index of the agent of a ciphertext encoded
+// by MarshalBinary, without decoding its group elements. Only the length of
+// the remaining data is checked, so a ciphertext may still fail to decode with
+// UnmarshalCiphertext. This makes it cheap to route or drop ciphertexts before
+// decoding them.
+func (sp *SystemParameters) PeekCiphertextIndex(data []byte) (int, error) {
+	d := decoder{sp: sp, data: data}
+	d.header(tagCiphertext)
+	index := d.int()
+	if d.err != nil {
+		return 0, d.err
+	}
+	if len(d.data) != 2*sp.G1Bytes() {
+		return 0, ErrMalformedData
+	}
+	return index, nil
+}
+
+// MarshalBinary encodes the rule token. A token generated by
+// NewTokenComposite is encoded with its own tag, followed by the index of its
+// agent.
+func (rt *RuleToken) MarshalBinary() ([]byte, error) {
+	if err := rt.check(); err != nil {
+		return nil, err
+	}
+	var e encoder
+	if rt.composite {
+		e.header(tagCompositeToken)
+		e.uvarint(uint64(rt.agent))
+	} else {
+		e.header(tagRuleToken)
+	}
+	e.uvarint(uint64(len(rt.indices)))
+	for i, v := range rt.indices {
+		e.uvarint(uint64(v))
+		e.elements(rt.g2u[i], rt.f2u[i])
+	}
+	e.elements(rt.product)
+	return e.buf, nil
+}
+
+// UnmarshalRuleToken decodes a rule token encoded by MarshalBinary. All
+// elements are checked to be in their groups, unless SkipGroupCheck is passed.
+// The number of pinned agents is limited by WithMaxAgents.
+func (sp *SystemParameters) UnmarshalRuleToken(data []byte, opts ...DecodeOption) (*RuleToken, error) {
+	d := sp.newDecoder(data, opts)
+	composite, agent := len(data) > 0 && data[0] == tagCompositeToken, 0
+	if composite {
+		d.header(tagCompositeToken)
+		agent = d.int()
+	} else {
+		d.header(tagRuleToken)
+	}
+	// Every component takes an index and two elements of G2.
+	n := d.agentCount(1 + 2*sp.G2Bytes())
+	if d.err != nil {
+		return nil, d.err
+	}
+	rt := &RuleToken{
+		indices:   make([]int, n),
+		g2u:       make([]*pbc.Element, n),
+		f2u:       make([]*pbc.Element, n),
+		composite: composite,
+		agent:     agent,
+	}
+	for i := range rt.indices {
+		rt.indices[i] = d.int()
+		rt.g2u[i] = d.g2()
+		rt.f2u[i] = d.g2()
+	}
+	rt.product = d.g2()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// MarshalCiphertextBatch encodes a batch of ciphertexts of the system
+// parameters in a columnar format: a fingerprint of the generators of the
+// system parameters, the number of ciphertexts, the indices of all ciphertexts,
+// followed by the first parts of all ciphertexts and then the second parts.
+// This is more compact and faster to decode than encoding every ciphertext on
+// its own. A ciphertext whose elements do not have the length of elements of G1
+// is rejected with ErrIncompatibleParameters, and nil ciphertexts are rejected
+// with ErrMalformedData.
+func (sp *SystemParameters) MarshalCiphertextBatch(cts []*Ciphertext) ([]byte, error) {
+	if err := sp.checkOpen(); err != nil {
+		return nil, err
+	}
+	size := sp.G1Bytes()
+	for _, ct := range cts {
+		if ct == nil || ct.part1 == nil || ct.part2 == nil {
+			return nil, ErrMalformedData
+		}
+		if ct.part1.BytesLen() != size || ct.part2.BytesLen() != size {
+			return nil, ErrIncompatibleParameters
+		}
+	}
+	var e encoder
+	e.buf = make([]byte, 0, 2+sha256.Size+binary.MaxVarintLen64*(len(cts)+1)+2*len(cts)*size)
+	e.header(tagCiphertextBatch)
+	fingerprint := sp.generatorFingerprint()
+	e.buf = append(e.buf, fingerprint[:]...)
+	e.uvarint(uint64(len(cts)))
+	for _, ct := range cts {
+		e.uvarint(uint64(ct.index))
+	}
+	for _, ct := range cts {
+		e.elements(ct.part1)
+	}
+	for _, ct := range cts {
+		e.elements(ct.part2)
+	}
+	return e.buf, nil
+}
+
+// UnmarshalCiphertextBatch decodes a batch of ciphertexts encoded by
+// MarshalCiphertextBatch. It returns ErrIncompatibleParameters if the batch was
+// encoded for system parameters with other generators. All parts are checked
+// to be valid members of G1, unless SkipGroupCheck is passed.
+func (sp *SystemParameters) UnmarshalCiphertextBatch(data []byte, opts ...DecodeOption) ([]*Ciphertext, error) {
+	d := sp.newDecoder(data, opts)
+	d.header(tagCiphertextBatch)
+	fingerprint := sp.generatorFingerprint()
+	if d.err == nil && len(d.data) < len(fingerprint) {
+		d.fail(ErrMalformedData)
+	} else if d.err == nil && !bytes.Equal(d.data[:len(fingerprint)], fingerprint[:]) {
+		d.fail(ErrIncompatibleParameters)
+	} else if d.err == nil {
+		d.data = d.data[len(fingerprint):]
+	}
+	// Every ciphertext takes an index and two elements of G1.
+	n := d.count(1 + 2*sp.G1Bytes())
+	if d.err != nil {
+		return nil, d.err
+	}
+	cts := make([]*Ciphertext, n)
+	for i := range cts {
+		cts[i] = &Ciphertext{index: d.int()}
+	}
+	for _, ct := range cts {
+		ct.part1 = d.g1()
+	}
+	for _, ct := range cts {
+		ct.part2 = d.g1()
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return cts, nil
+}
+
+// generatorFingerprint returns a SHA-256 hash of the generators of the system
+// parameters. The generators differ between systems, even on the same curve.
+func (sp *SystemParameters) generatorFingerprint() [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(sp.g1.Bytes())
+	h.Write(sp.g2.Bytes())
+	var fingerprint [sha256.Size]byte
+	copy(fingerprint[:], h.Sum(nil))
+	return fingerprint
+}
+
+// SafeDecodeCiphertext decodes a ciphertext encoded by MarshalBinary from
+// untrusted data. It never panics: any panic while decoding is reported as
+// ErrMalformedData. Length prefixes are checked against the data before
+// anything is allocated.
+func (sp *SystemParameters) SafeDecodeCiphertext(data []byte) (ct *Ciphertext, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ct, err = nil, ErrMalformedData
+		}
+	}()
+	return sp.UnmarshalCiphertext(data)
+}
+
+// SafeDecodeRuleToken decodes a rule token encoded by MarshalBinary from
+// untrusted data, with the same guarantees as SafeDecodeCiphertext. The
+// options are passed to UnmarshalRuleToken.
+func (sp *SystemParameters) SafeDecodeRuleToken(data []byte, opts ...DecodeOption) (rt *RuleToken, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rt, err = nil, ErrMalformedData
+		}
+	}()
+	return sp.UnmarshalRuleToken(data, opts...)
+}
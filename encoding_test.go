@@ -0,0 +1,343 @@
+package crypmonsys
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestMakeCiphertext(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	identifier := "identifier"
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, v := range []int32{16, 42, 12} {
+		ct := agents[i].NewCiphertext(identifier, v)
+		if ciphertexts[i], err = sp.MakeCiphertext(i, ct.part1.Bytes(), ct.part2.Bytes()); err != nil {
+			t.Fatal("Error making ciphertext: ", err)
+		}
+	}
+	if !NewAlarmSystem(sp, ruletoken, identifier).Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+
+	valid := ciphertexts[0].part1.Bytes()
+	random := make([]byte, len(valid))
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.MakeCiphertext(0, random, valid); err != ErrInvalidElement {
+		t.Fatal("Expected ErrInvalidElement for random bytes, got: ", err)
+	}
+	if _, err := sp.MakeCiphertext(0, valid[1:], valid); err != ErrInvalidElement {
+		t.Fatal("Expected ErrInvalidElement for truncated bytes, got: ", err)
+	}
+	if _, err := sp.MakeCiphertext(-1, valid, valid); err != ErrInvalidAgentIndex {
+		t.Fatal("Expected ErrInvalidAgentIndex for a negative index, got: ", err)
+	}
+}
+
+func TestDecodeRandomElements(t *testing.T) {
+	_, agents := testSetupKey.GenerateKeys(1, 8)
+	sp := testSetupKey.sp
+
+	valid := agents[0].NewCiphertext("identifier", 16)
+	part1, part2 := valid.part1.Bytes(), valid.part2.Bytes()
+
+	random := make([]byte, len(part1))
+	for i := 0; i < 50; i++ {
+		if _, err := rand.Read(random); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sp.MakeCiphertext(0, random, part2); err != ErrInvalidElement {
+			t.Fatal("Expected ErrInvalidElement for random bytes, got: ", err)
+		}
+	}
+
+	if _, err := sp.MakeCiphertext(0, part1, part2, SkipGroupCheck()); err != nil {
+		t.Fatal("Error decoding valid elements without group check: ", err)
+	}
+	if _, err := sp.MakeCiphertext(0, part1[1:], part2, SkipGroupCheck()); err != ErrInvalidElement {
+		t.Fatal("Expected ErrInvalidElement for truncated bytes without group check, got: ", err)
+	}
+}
+
+func TestPeekCiphertextIndex(t *testing.T) {
+	_, agents := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	for i, agent := range agents {
+		data, err := agent.NewCiphertext("identifier", 16).MarshalBinary()
+		if err != nil {
+			t.Fatal("Error marshaling ciphertext: ", err)
+		}
+		index, err := sp.PeekCiphertextIndex(data)
+		if err != nil {
+			t.Fatal("Error peeking ciphertext index: ", err)
+		}
+		if index != i {
+			t.Fatalf("Peeked index %d, expected %d.", index, i)
+		}
+		ct, err := sp.UnmarshalCiphertext(data)
+		if err != nil {
+			t.Fatal("Error unmarshaling ciphertext: ", err)
+		}
+		if ct.index != i {
+			t.Fatalf("Unmarshaled index %d, expected %d.", ct.index, i)
+		}
+
+		for _, n := range []int{0, 1, 2, 3, len(data) - 1} {
+			if _, err := sp.PeekCiphertextIndex(data[:n]); err != ErrMalformedData {
+				t.Fatalf("Expected ErrMalformedData for %d of %d bytes, got: %v", n, len(data), err)
+			}
+		}
+	}
+}
+
+func TestUnmarshalAgentInfo(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	var infos []AgentInfo
+	for _, info := range rulegenerator.Agents() {
+		data, err := info.Marshal()
+		if err != nil {
+			t.Fatal("Error marshaling agent info: ", err)
+		}
+		if info, err = sp.UnmarshalAgentInfo(data); err != nil {
+			t.Fatal("Error unmarshaling agent info: ", err)
+		}
+		infos = append(infos, info)
+	}
+	if _, err := sp.UnmarshalAgentInfo(nil); err != ErrMalformedData {
+		t.Fatal("Expected ErrMalformedData for empty data, got: ", err)
+	}
+
+	ruletoken, err := NewRuleGenerator(sp, infos).NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 12),
+	}
+	if !NewAlarmSystem(sp, ruletoken, "identifier").Test(ciphertexts) {
+		t.Fatal("Token of the reconstructed rule generator did not match.")
+	}
+}
+
+func FuzzDecodeCiphertext(f *testing.F) {
+	_, agents := testSetupKey.GenerateKeys(2, 8)
+	sp := testSetupKey.sp
+	for _, agent := range agents {
+		data, err := agent.NewCiphertext("identifier", 16).MarshalBinary()
+		if err != nil {
+			f.Fatal("Error marshaling ciphertext: ", err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{tagCiphertext, encodingVersion, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ct, err := sp.SafeDecodeCiphertext(data)
+		if err != nil {
+			return
+		}
+		encoded, err := ct.MarshalBinary()
+		if err != nil {
+			t.Fatal("Error marshaling decoded ciphertext: ", err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatal("Decoded ciphertext does not encode to its input.")
+		}
+	})
+}
+
+func FuzzDecodeRuleToken(f *testing.F) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+	for _, rule := range [][]int32{{16, -1, 12}, {-1, -1, -1}} {
+		ruletoken, err := rulegenerator.NewToken(rule)
+		if err != nil {
+			f.Fatal("Error creating token: ", err)
+		}
+		data, err := ruletoken.MarshalBinary()
+		if err != nil {
+			f.Fatal("Error marshaling token: ", err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{tagRuleToken, encodingVersion, 0x80, 0x94, 0xeb, 0xdc, 0x03})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rt, err := sp.SafeDecodeRuleToken(data)
+		if err != nil {
+			return
+		}
+		encoded, err := rt.MarshalBinary()
+		if err != nil {
+			t.Fatal("Error marshaling decoded token: ", err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatal("Decoded token does not encode to its input.")
+		}
+	})
+}
+
+func TestMaxAgents(t *testing.T) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	// A header claiming a billion components, without any data.
+	billion := []byte{tagRuleToken, encodingVersion, 0x80, 0x94, 0xeb, 0xdc, 0x03}
+	if _, err := sp.UnmarshalRuleToken(billion); err != ErrTooManyComponents {
+		t.Fatal("Expected ErrTooManyComponents for a billion components, got: ", err)
+	}
+	if _, err := sp.SafeDecodeRuleToken(billion, WithMaxAgents(2e9)); err != ErrMalformedData {
+		t.Fatal("Expected ErrMalformedData for missing components, got: ", err)
+	}
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, 42, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	data, err := ruletoken.MarshalBinary()
+	if err != nil {
+		t.Fatal("Error marshaling token: ", err)
+	}
+	if _, err := sp.UnmarshalRuleToken(data, WithMaxAgents(2)); err != ErrTooManyComponents {
+		t.Fatal("Expected ErrTooManyComponents for three components, got: ", err)
+	}
+	if _, err := sp.UnmarshalRuleToken(data, WithMaxAgents(rulegenerator.NumAgents())); err != nil {
+		t.Fatal("Error unmarshaling token: ", err)
+	}
+}
+
+func TestRuleTokenRoundTrip(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	data, err := ruletoken.MarshalBinary()
+	if err != nil {
+		t.Fatal("Error marshaling token: ", err)
+	}
+	decoded, err := sp.UnmarshalRuleToken(data)
+	if err != nil {
+		t.Fatal("Error unmarshaling token: ", err)
+	}
+
+	identifier := "identifier"
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, v := range []int32{16, 42, 12} {
+		ciphertexts[i] = agents[i].NewCiphertext(identifier, v)
+	}
+	if !NewAlarmSystem(sp, decoded, identifier).Test(ciphertexts) {
+		t.Fatal("No alarm was raised for the decoded token, whereas an alarm should have been raised.")
+	}
+	ciphertexts[2] = agents[2].NewCiphertext(identifier, 13)
+	if NewAlarmSystem(sp, decoded, identifier).Test(ciphertexts) {
+		t.Fatal("An alarm was raised for the decoded token, whereas no alarm should have been raised.")
+	}
+}
+
+func benchmarkCiphertexts(n int) []*Ciphertext {
+	_, agents := testSetupKey.GenerateKeys(3, 8)
+	cts := make([]*Ciphertext, n)
+	for i := range cts {
+		cts[i] = agents[i%len(agents)].NewCiphertext("identifier", int32(i%256))
+	}
+	return cts
+}
+
+func TestCiphertextBatch(t *testing.T) {
+	sp := testSetupKey.sp
+	cts := benchmarkCiphertexts(500)
+
+	data, err := sp.MarshalCiphertextBatch(cts)
+	if err != nil {
+		t.Fatal("Error marshaling batch: ", err)
+	}
+	decoded, err := sp.UnmarshalCiphertextBatch(data)
+	if err != nil {
+		t.Fatal("Error unmarshaling batch: ", err)
+	}
+	if len(decoded) != len(cts) {
+		t.Fatalf("Got %d ciphertexts, expected %d.", len(decoded), len(cts))
+	}
+	for i, ct := range decoded {
+		if ct.index != cts[i].index || !ct.part1.Equals(cts[i].part1) || !ct.part2.Equals(cts[i].part2) {
+			t.Fatalf("Ciphertext %d differs after the round trip.", i)
+		}
+	}
+
+	for _, n := range []int{0, 2, 3, len(data) - 1} {
+		if _, err := sp.UnmarshalCiphertextBatch(data[:n]); err != ErrMalformedData {
+			t.Fatalf("Expected ErrMalformedData for %d of %d bytes, got: %v", n, len(data), err)
+		}
+	}
+	if _, err := sp.MarshalCiphertextBatch([]*Ciphertext{cts[0], nil}); err != ErrMalformedData {
+		t.Fatal("Expected ErrMalformedData for a nil ciphertext, got: ", err)
+	}
+
+	// A batch of a system on the same curve, but with other generators.
+	other := NewSystemParameters(sp.pairing)
+	if _, err := other.UnmarshalCiphertextBatch(data); err != ErrIncompatibleParameters {
+		t.Fatal("Expected ErrIncompatibleParameters for a batch of other generators, got: ", err)
+	}
+
+	// A ciphertext of a system on another curve.
+	spA, err := NewSystemParametersFromParamFile("testdata/a.param")
+	if err != nil {
+		t.Fatal("Error loading parameters: ", err)
+	}
+	_, agentsA := NewSetupKey(spA).GenerateKeys(1, 8)
+	if _, err := sp.MarshalCiphertextBatch([]*Ciphertext{cts[0], agentsA[0].NewCiphertext("identifier", 1)}); err != ErrIncompatibleParameters {
+		t.Fatal("Expected ErrIncompatibleParameters for a ciphertext of another curve, got: ", err)
+	}
+}
+
+func BenchmarkUnmarshalCiphertextBatch500(b *testing.B) {
+	sp := testSetupKey.sp
+	data, err := sp.MarshalCiphertextBatch(benchmarkCiphertexts(500))
+	if err != nil {
+		b.Fatal("Error marshaling batch: ", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sp.UnmarshalCiphertextBatch(data); err != nil {
+			b.Fatal("Error unmarshaling batch: ", err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalCiphertexts500(b *testing.B) {
+	sp := testSetupKey.sp
+	var data [][]byte
+	for _, ct := range benchmarkCiphertexts(500) {
+		encoded, err := ct.MarshalBinary()
+		if err != nil {
+			b.Fatal("Error marshaling ciphertext: ", err)
+		}
+		data = append(data, encoded)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, encoded := range data {
+			if _, err := sp.UnmarshalCiphertext(encoded); err != nil {
+				b.Fatal("Error unmarshaling ciphertext: ", err)
+			}
+		}
+	}
+}
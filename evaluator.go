@@ -0,0 +1,188 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Window holds the ciphertexts of the agents for a single identifier. The
+// ciphertext of agent i should be at position i.
+type Window struct {
+	Identifier  string
+	Ciphertexts []*Ciphertext
+}
+
+// Result holds the outcome of evaluating the tokens of an Evaluator against a
+// window. Matches[i] reports whether the i-th token matched.
+type Result struct {
+	Identifier string
+	Matches    []bool
+}
+
+// EvaluatorConfig bounds the concurrency of an Evaluator.
+type EvaluatorConfig struct {
+	// MaxConcurrency is the number of windows evaluated at the same time. With
+	// a value of at most 1, windows are evaluated one by one, but still
+	// buffered and dropped according to QueueDepth and DropWhenFull.
+	MaxConcurrency int
+	// QueueDepth is the number of windows that are buffered while all
+	// evaluations are in progress.
+	QueueDepth int
+	// DropWhenFull drops windows that arrive while the queue is full, instead
+	// of blocking the sender until there is room. The number of dropped
+	// windows is reported by Dropped and to the Metrics collector of the
+	// system parameters.
+	DropWhenFull bool
+}
+
+// Evaluator continuously evaluates a fixed set of tokens against a stream of
+// windows.
+type Evaluator struct {
+	sp     *SystemParameters
+	tokens []*RuleToken
+	config EvaluatorConfig
+
+	dropped atomic.Int64
+}
+
+// evaluate evaluates the tokens of as against the window. It is a variable,
+// so tests can observe the evaluations.
+var evaluate = func(as *AlarmSystemMulti, w Window) Result {
+	as.SetIdentifier(w.Identifier)
+	return Result{Identifier: w.Identifier, Matches: as.EvaluateAll(w.Ciphertexts)}
+}
+
+// NewEvaluator creates a new evaluator for the tokens.
+func NewEvaluator(sp *SystemParameters, tokens ...*RuleToken) *Evaluator {
+	return NewEvaluatorWithConfig(sp, EvaluatorConfig{}, tokens...)
+}
+
+// NewEvaluatorWithConfig creates a new evaluator for the tokens with bounded
+// concurrency.
+func NewEvaluatorWithConfig(sp *SystemParameters, config EvaluatorConfig, tokens ...*RuleToken) *Evaluator {
+	return &Evaluator{
+		sp:     sp,
+		tokens: append([]*RuleToken(nil), tokens...),
+		config: config,
+	}
+}
+
+// Dropped returns the number of windows dropped because the queue was full.
+func (e *Evaluator) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// Run evaluates the tokens against every window received from in and sends a
+// result for each window to out. A single alarm system is rebound to the
+// identifier of every window, so the tokens are reused across windows. Run
+// returns nil once in is closed and all results are sent, or the error of ctx
+// once it is done. In both cases out is closed.
+//
+// With a non-zero configuration, windows are queued for MaxConcurrency
+// workers, or a single worker if it is at most 1. Every worker has its own
+// alarm system and copy of the tokens. With more than one worker, results may
+// be sent in a different order than the windows were received. Otherwise
+// results are sent in order.
+func (e *Evaluator) Run(ctx context.Context, in <-chan Window, out chan<- Result) error {
+	defer close(out)
+	if err := e.sp.checkOpen(); err != nil {
+		return err
+	}
+	if e.config != (EvaluatorConfig{}) {
+		return e.runConcurrent(ctx, in, out)
+	}
+	as := NewAlarmSystemMulti(e.sp, e.tokens, "")
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case w, ok := <-in:
+			if !ok {
+				return nil
+			}
+			select {
+			case out <- evaluate(as, w):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// runConcurrent feeds the windows from in into a queue from which
+// MaxConcurrency workers, but at least one, evaluate them.
+func (e *Evaluator) runConcurrent(ctx context.Context, in <-chan Window, out chan<- Result) error {
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan Window, e.config.QueueDepth)
+	var wg sync.WaitGroup
+	for i := 0; i < max(e.config.MaxConcurrency, 1); i++ {
+		tokens := make([]*RuleToken, len(e.tokens))
+		for j, rt := range e.tokens {
+			tokens[j] = rt.clone(e.sp)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.work(workCtx, NewAlarmSystemMulti(e.sp, tokens, ""), queue, out)
+		}()
+	}
+
+	err := e.feed(ctx, in, queue)
+	close(queue)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// feed moves windows from in to the queue until in is closed or ctx is done.
+func (e *Evaluator) feed(ctx context.Context, in <-chan Window, queue chan<- Window) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case w, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if e.config.DropWhenFull {
+				select {
+				case queue <- w:
+				default:
+					e.dropped.Add(1)
+					e.sp.collector().IncDropped()
+				}
+				continue
+			}
+			select {
+			case queue <- w:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// work evaluates the windows from the queue with as until the queue is closed
+// or ctx is done.
+func (e *Evaluator) work(ctx context.Context, as *AlarmSystemMulti, queue <-chan Window, out chan<- Result) {
+	for w := range queue {
+		select {
+		case out <- evaluate(as, w):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
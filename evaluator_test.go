@@ -0,0 +1,216 @@
+package crypmonsys
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEvaluator(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	token1, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	token2, err := rulegenerator.NewToken([]int32{-1, 42, -1})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	evaluator := NewEvaluator(testSetupKey.sp, token1, token2)
+
+	const windows = 100
+	in := make(chan Window)
+	out := make(chan Result)
+	done := make(chan error, 1)
+	go func() {
+		done <- evaluator.Run(context.Background(), in, out)
+	}()
+
+	go func() {
+		for w := 0; w < windows; w++ {
+			identifier := fmt.Sprintf("window-%d", w)
+			// Agent 0 only reports 16 in even windows.
+			in <- Window{
+				Identifier: identifier,
+				Ciphertexts: []*Ciphertext{
+					agents[0].NewCiphertext(identifier, int32(16+w%2)),
+					agents[1].NewCiphertext(identifier, 42),
+					agents[2].NewCiphertext(identifier, 12),
+				},
+			}
+		}
+		close(in)
+	}()
+
+	w := 0
+	for result := range out {
+		if result.Identifier != fmt.Sprintf("window-%d", w) {
+			t.Fatalf("Got result for %s, expected window-%d.", result.Identifier, w)
+		}
+		if result.Matches[0] != (w%2 == 0) || !result.Matches[1] {
+			t.Fatalf("Window %d: got %v.", w, result.Matches)
+		}
+		w++
+	}
+	if w != windows {
+		t.Fatalf("Got %d results, expected %d.", w, windows)
+	}
+	if err := <-done; err != nil {
+		t.Fatal("Run returned an error: ", err)
+	}
+}
+
+func TestEvaluatorCancel(t *testing.T) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(1, 8)
+	evaluator := NewEvaluator(testSetupKey.sp, rulegenerator.NewWildcardToken())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan Result)
+	cancel()
+	if err := evaluator.Run(ctx, make(chan Window), out); err != context.Canceled {
+		t.Fatal("Expected context.Canceled, got: ", err)
+	}
+	if _, ok := <-out; ok {
+		t.Fatal("Output channel was not closed.")
+	}
+}
+
+func TestEvaluatorConcurrency(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 8)
+	token, err := rulegenerator.NewToken([]int32{16, -1})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	const maxConcurrency = 3
+	evaluator := NewEvaluatorWithConfig(testSetupKey.sp, EvaluatorConfig{MaxConcurrency: maxConcurrency, QueueDepth: 4}, token)
+
+	// Track the evaluations in progress, and hold the first ones until
+	// maxConcurrency of them are in progress, so the workers are guaranteed
+	// to overlap.
+	var entered, inFlight, peak atomic.Int64
+	release := make(chan struct{})
+	evaluateWindow := evaluate
+	defer func() { evaluate = evaluateWindow }()
+	evaluate = func(as *AlarmSystemMulti, w Window) Result {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		if entered.Add(1) == maxConcurrency {
+			close(release)
+		}
+		<-release
+		return evaluateWindow(as, w)
+	}
+
+	// Create the flood of windows up front, so they arrive as fast as possible.
+	const windows = 200
+	flood := make([]Window, windows)
+	for w := range flood {
+		identifier := fmt.Sprintf("window-%d", w)
+		flood[w] = Window{
+			Identifier: identifier,
+			Ciphertexts: []*Ciphertext{
+				agents[0].NewCiphertext(identifier, int32(16+w%2)),
+				agents[1].NewCiphertext(identifier, 42),
+			},
+		}
+	}
+
+	in := make(chan Window)
+	out := make(chan Result)
+	done := make(chan error, 1)
+	go func() {
+		done <- evaluator.Run(context.Background(), in, out)
+	}()
+	go func() {
+		for _, w := range flood {
+			in <- w
+		}
+		close(in)
+	}()
+
+	seen := make(map[string]bool)
+	for result := range out {
+		var w int
+		if _, err := fmt.Sscanf(result.Identifier, "window-%d", &w); err != nil {
+			t.Fatal("Unexpected identifier ", result.Identifier)
+		}
+		if seen[result.Identifier] {
+			t.Fatalf("Got two results for %s.", result.Identifier)
+		}
+		seen[result.Identifier] = true
+		if result.Matches[0] != (w%2 == 0) {
+			t.Fatalf("Window %d: got %v.", w, result.Matches)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal("Run returned an error: ", err)
+	}
+	if len(seen) != windows {
+		t.Fatalf("Got %d results, expected %d.", len(seen), windows)
+	}
+	if peak := peak.Load(); peak > maxConcurrency {
+		t.Fatalf("Peak concurrency %d exceeds %d.", peak, maxConcurrency)
+	} else if peak <= 1 {
+		t.Fatalf("Peak concurrency %d, expected concurrent evaluations.", peak)
+	}
+	if evaluator.Dropped() != 0 {
+		t.Fatalf("Dropped %d windows while blocking.", evaluator.Dropped())
+	}
+}
+
+// droppedMetrics counts like CountingMetrics and signals every dropped window.
+type droppedMetrics struct {
+	CountingMetrics
+	dropped chan struct{}
+}
+
+func (m *droppedMetrics) IncDropped() {
+	m.CountingMetrics.IncDropped()
+	m.dropped <- struct{}{}
+}
+
+func TestEvaluatorDropWhenFull(t *testing.T) {
+	for _, maxConcurrency := range []int{1, 2} {
+		testEvaluatorDropWhenFull(t, maxConcurrency)
+	}
+}
+
+func testEvaluatorDropWhenFull(t *testing.T, maxConcurrency int) {
+	const windows = 10
+	sp := NewSystemParameters(testSetupKey.sp.pairing)
+	metrics := &droppedMetrics{dropped: make(chan struct{}, windows)}
+	sp.SetMetrics(metrics)
+	rulegenerator, _ := NewSetupKey(sp).GenerateKeys(1, 8)
+	evaluator := NewEvaluatorWithConfig(sp, EvaluatorConfig{MaxConcurrency: maxConcurrency, QueueDepth: 1, DropWhenFull: true}, rulegenerator.NewWildcardToken())
+
+	// Nobody reads the results, so each worker blocks with a single window and
+	// the queue fills up with another, and the remaining windows are dropped.
+	in := make(chan Window, windows)
+	for w := 0; w < windows; w++ {
+		in <- Window{Identifier: fmt.Sprintf("window-%d", w)}
+	}
+	close(in)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- evaluator.Run(ctx, in, make(chan Result))
+	}()
+	for i := 0; i < windows-maxConcurrency-1; i++ {
+		<-metrics.dropped
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatal("Expected context.Canceled, got: ", err)
+	}
+	if n := metrics.Dropped.Load(); n != evaluator.Dropped() {
+		t.Fatalf("Collector counted %d dropped windows, evaluator %d.", n, evaluator.Dropped())
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"crypto/sha256"
+	"github.com/Nik-U/pbc"
+)
+
+// TestTrace records the structure of a test of a token against ciphertexts, to
+// diagnose unexpected outcomes. It contains fingerprints of the computed
+// elements of GT, which reveal neither plaintexts nor rule values.
+//
+// A test compares P1 = Π e(part1_i, f2u_i) · e(H(ID), product) with
+// P2 = Π e(part2_i, g2u_i). If the ciphertexts encrypt the values of the token,
+// the residual P2 / Π e(part1_i, f2u_i) equals e(H(ID'), product), where ID' is
+// the identifier the ciphertexts were created for. So if the residual equals
+// the IdentifierFactor of the alarm system for another identifier, the values
+// match but the identifiers differ. If it equals no identifier factor, the
+// values differ.
+type TestTrace struct {
+	// Indices holds the indices of the agents pinned by the token, whose
+	// ciphertexts were included in the test. For a token generated by
+	// NewTokenComposite, these are the positions of the pinned attributes.
+	Indices []int
+	// Missing holds the pinned indices without a ciphertext, or for a
+	// composite token, without a ciphertext of its agent. If any are
+	// missing, no pairings are computed and the fingerprints are zero.
+	Missing []int
+	// P1 and P2 are the fingerprints of the compared elements.
+	P1, P2 [32]byte
+	// Residual is the fingerprint of the residual.
+	Residual [32]byte
+	// IdentifierFactor is the fingerprint of e(H(ID), product) for the
+	// identifier of the alarm system.
+	IdentifierFactor [32]byte
+}
+
+// Explain tests the ciphertexts like TestChecked and returns a trace of the
+// test. Like TestChecked, it returns an error if the token constrains a
+// revoked agent. It is slower than Test and meant for debugging only.
+func (as *AlarmSystem) Explain(ct []*Ciphertext) (bool, *TestTrace, error) {
+	if err := as.sp.checkOpen(); err != nil {
+		return false, nil, err
+	}
+	if err := as.rt.check(); err != nil {
+		return false, nil, err
+	}
+	if err := as.checkRevoked(); err != nil {
+		return false, nil, err
+	}
+	idFactor := as.sp.pairing.NewGT().Pair(as.hID, as.rt.product)
+	trace := &TestTrace{
+		Indices:          append([]int(nil), as.rt.indices...),
+		IdentifierFactor: gtFingerprint(idFactor),
+	}
+	for _, v := range as.rt.indices {
+		if as.rt.ciphertextAt(ct, v) == nil {
+			trace.Missing = append(trace.Missing, v)
+		}
+	}
+	if len(trace.Missing) > 0 {
+		return false, trace, nil
+	}
+
+	// Start from the products over no pairings, which equal 1.
+	pairings1 := as.sp.pairing.NewGT().Set1()
+	p2 := as.sp.pairing.NewGT().Set1()
+	for i, v := range as.rt.indices {
+		pairings1.ThenMul(as.sp.pairing.NewGT().Pair(ct[v].part1, as.rt.f2u[i]))
+		p2.ThenMul(as.sp.pairing.NewGT().Pair(ct[v].part2, as.rt.g2u[i]))
+	}
+	p1 := as.sp.pairing.NewGT().Mul(pairings1, idFactor)
+	trace.P1 = gtFingerprint(p1)
+	trace.P2 = gtFingerprint(p2)
+	trace.Residual = gtFingerprint(as.sp.pairing.NewGT().Div(p2, pairings1))
+	return as.sp.equal(p1, p2), trace, nil
+}
+
+// IdentifierFactor returns the fingerprint of e(H(identifier), product) for
+// the token of the alarm system, to compare with the Residual of a trace.
+func (as *AlarmSystem) IdentifierFactor(identifier string) [32]byte {
+	hID := as.sp.pairing.NewG1().SetFromStringHash(identifier, sha256.New())
+	return gtFingerprint(as.sp.pairing.NewGT().Pair(hID, as.rt.product))
+}
+
+// gtFingerprint returns a SHA-256 hash of an element.
+func gtFingerprint(el *pbc.Element) [32]byte {
+	return sha256.Sum256(el.Bytes())
+}
@@ -0,0 +1,60 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, "identifier")
+
+	ciphertexts := func(identifier string, v int32) []*Ciphertext {
+		return []*Ciphertext{
+			agents[0].NewCiphertext(identifier, 16),
+			agents[1].NewCiphertext(identifier, 42),
+			agents[2].NewCiphertext(identifier, v),
+		}
+	}
+
+	match, trace, err := alarmsystem.Explain(ciphertexts("identifier", 12))
+	if err != nil {
+		t.Fatal("Error explaining test: ", err)
+	}
+	if !match || trace.P1 != trace.P2 || trace.Residual != trace.IdentifierFactor {
+		t.Fatalf("Unexpected trace for matching ciphertexts: %v %+v", match, trace)
+	}
+	if len(trace.Indices) != 2 || trace.Indices[0] != 0 || trace.Indices[1] != 2 {
+		t.Fatalf("Trace includes indices %v, expected [0 2].", trace.Indices)
+	}
+
+	// The ciphertexts are for another identifier: the residual is the
+	// identifier factor of that identifier.
+	match, trace, err = alarmsystem.Explain(ciphertexts("other identifier", 12))
+	if err != nil {
+		t.Fatal("Error explaining test: ", err)
+	}
+	if match || trace.Residual == trace.IdentifierFactor || trace.Residual != alarmsystem.IdentifierFactor("other identifier") {
+		t.Fatalf("Identifier mismatch not recognizable from the trace: %v %+v", match, trace)
+	}
+
+	// A value differs: the residual is no identifier factor.
+	match, trace, err = alarmsystem.Explain(ciphertexts("identifier", 13))
+	if err != nil {
+		t.Fatal("Error explaining test: ", err)
+	}
+	if match || trace.Residual == trace.IdentifierFactor || trace.Residual == alarmsystem.IdentifierFactor("other identifier") {
+		t.Fatalf("Value mismatch not recognizable from the trace: %v %+v", match, trace)
+	}
+
+	match, trace, err = alarmsystem.Explain(ciphertexts("identifier", 12)[:2])
+	if err != nil {
+		t.Fatal("Error explaining test: ", err)
+	}
+	if match || len(trace.Missing) != 1 || trace.Missing[0] != 2 {
+		t.Fatalf("Missing ciphertext not recorded: %v %+v", match, trace)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxEnumeratedBits is the largest message space for which tokens are
+// generated for every possible value.
+const maxEnumeratedBits = 8
+
+var (
+	// ErrMessageSpaceTooLarge is an error that is issued when an operation
+	// would need a token for every value of a message space that is too large.
+	ErrMessageSpaceTooLarge = errors.New("Message space is too large to enumerate.")
+)
+
+// CrossWindowIdentifier returns the identifier for a rule that correlates the
+// statuses of agents across several time windows.
+//
+// A token cannot be evaluated against ciphertexts with different identifiers:
+// the token only holds the product of the identifier terms g2^(gamma_i u_i) of
+// all pinned agents, which is paired with the single H(ID) of the alarm system.
+// The individual terms are deliberately not part of the token, as they would
+// allow testing each component of the rule on its own. To evaluate a rule such
+// as "agent A in window t and agent B in window t+1", every agent involved
+// encrypts its status of the relevant window under the joint identifier
+// CrossWindowIdentifier(t, t+1), and the alarm system is bound to that same
+// identifier.
+//
+// The windows are encoded unambiguously, so different lists of windows never
+// yield the same identifier.
+func CrossWindowIdentifier(windows ...string) string {
+	var b strings.Builder
+	b.WriteString("crypmonsys/cross-window")
+	for _, w := range windows {
+		b.WriteByte('/')
+		b.WriteString(strconv.Itoa(len(w)))
+		b.WriteByte(':')
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// SequenceIdentifier returns the identifier for window seq of the series of
+// windows named base. Binding ciphertexts to a sequence number prevents a
+// ciphertext captured in one window from being replayed in another window of
+// the same series. SequenceIdentifier never returns the same identifier for
+// different pairs of base and seq.
+func SequenceIdentifier(base string, seq uint64) string {
+	return "crypmonsys/sequence/" + strconv.Itoa(len(base)) + ":" + base + "/" + strconv.FormatUint(seq, 10)
+}
+
+// NewCiphertextSeq creates a new ciphertext of a message that is attached to
+// window seq of the series base. The agent should use a monotonically
+// increasing sequence number for every window.
+func (a *Agent) NewCiphertextSeq(base string, seq uint64, plaintext int32) *Ciphertext {
+	return a.NewCiphertext(SequenceIdentifier(base, seq), plaintext)
+}
+
+// NewAlarmSystemSeq creates a new alarm system for window seq of the series
+// base. It only matches ciphertexts created with NewCiphertextSeq for the same
+// window.
+func NewAlarmSystemSeq(sp *SystemParameters, rt *RuleToken, base string, seq uint64) *AlarmSystem {
+	return NewAlarmSystem(sp, rt, SequenceIdentifier(base, seq))
+}
+
+// SetSequence binds the alarm system to window seq of the series base.
+func (as *AlarmSystem) SetSequence(base string, seq uint64) {
+	as.SetIdentifier(SequenceIdentifier(base, seq))
+}
+
+// IdentifierToken allows an alarm system to check that ciphertexts are bound
+// to its identifier, regardless of their values. It is created with
+// NewIdentifierToken and used with TestIdentifier.
+type IdentifierToken struct {
+	// agents[i] holds, in random order, a token pinning agent i for every
+	// value of its message space.
+	agents [][]*RuleToken
+}
+
+// NewIdentifierToken generates an identifier token for all agents known to the
+// rule generator.
+//
+// A ciphertext can only be tested against a token for a specific value, so
+// there is no token that ignores the value of an agent while still involving
+// its ciphertext. Instead, the identifier token holds a token for every value
+// of every agent, which makes it linear in the size of the message spaces: it
+// is only available for agents with at most 8 bits, otherwise
+// ErrMessageSpaceTooLarge is returned. The tokens of an agent are not labeled
+// with their value and are shuffled, but an alarm system holding an identifier
+// token does learn whether two ciphertexts of an agent hold the same value.
+func (rg *RuleGenerator) NewIdentifierToken() (*IdentifierToken, error) {
+	for _, info := range rg.agents {
+		if len(info.beta) > maxEnumeratedBits {
+			return nil, ErrMessageSpaceTooLarge
+		}
+	}
+	it := &IdentifierToken{agents: make([][]*RuleToken, len(rg.agents))}
+	rules := make([]int32, len(rg.agents))
+	for i := range rules {
+		rules[i] = Wildcard
+	}
+	for i, info := range rg.agents {
+		tokens := make([]*RuleToken, 1<<uint(len(info.beta)))
+		for v := range tokens {
+			rules[i] = int32(v)
+			rt, err := rg.NewToken(rules)
+			if err != nil {
+				return nil, err
+			}
+			tokens[v] = rt
+		}
+		rules[i] = Wildcard
+		if err := shuffleTokens(tokens); err != nil {
+			return nil, err
+		}
+		it.agents[i] = tokens
+	}
+	return it, nil
+}
+
+// shuffleTokens shuffles the tokens using a cryptographically secure source.
+func shuffleTokens(tokens []*RuleToken) error {
+	for i := len(tokens) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return err
+		}
+		tokens[i], tokens[j.Int64()] = tokens[j.Int64()], tokens[i]
+	}
+	return nil
+}
+
+// TestIdentifier tests whether the ciphertexts are bound to the identifier of
+// the alarm system. It reports true if, for every agent of the identifier
+// token, ct holds a ciphertext generated by that agent for some value under
+// the identifier of the alarm system. The rule token of the alarm system is not
+// used.
+func (as *AlarmSystem) TestIdentifier(it *IdentifierToken, ct []*Ciphertext) bool {
+	hIDPairer := as.hID.PreparePairer()
+	for _, tokens := range it.agents {
+		found := false
+		for _, rt := range tokens {
+			idFactor := as.sp.pairing.NewGT().PairerPair(hIDPairer, rt.product)
+			if as.sp.test(rt, idFactor, ct) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestCrossWindowIdentifier(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 8)
+
+	// Agent 0 reports 16 in window t, agent 1 reports 12 in window t+1.
+	joint := CrossWindowIdentifier("window-t", "window-t+1")
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext(joint, 16),
+		agents[1].NewCiphertext(joint, 12),
+	}
+	if !NewAlarmSystem(testSetupKey.sp, ruletoken, joint).Test(ciphertexts) {
+		t.Fatal("No alarm was raised for the cross-window rule.")
+	}
+
+	// Ciphertexts of the individual windows do not match.
+	separate := []*Ciphertext{
+		agents[0].NewCiphertext("window-t", 16),
+		agents[1].NewCiphertext("window-t+1", 12),
+	}
+	if NewAlarmSystem(testSetupKey.sp, ruletoken, joint).Test(separate) {
+		t.Fatal("Alarm was raised for ciphertexts of separate windows.")
+	}
+
+	if CrossWindowIdentifier("a", "bc") == CrossWindowIdentifier("ab", "c") {
+		t.Fatal("Different windows yield the same identifier.")
+	}
+}
+
+func TestIdentifierToken(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 2)
+
+	identifier := "identifier"
+	otherIdentifier := "some other identifier"
+
+	it, err := rulegenerator.NewIdentifierToken()
+	if err != nil {
+		t.Fatal("Error creating identifier token: ", err)
+	}
+	// The rule token of the alarm system is irrelevant.
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, rulegenerator.NewWildcardToken(), identifier)
+
+	for v := int32(0); v < 4; v++ {
+		ciphertexts := []*Ciphertext{
+			agents[0].NewCiphertext(identifier, v),
+			agents[1].NewCiphertext(identifier, 3-v),
+		}
+		if !alarmsystem.TestIdentifier(it, ciphertexts) {
+			t.Fatalf("Ciphertexts for value %d are not bound to the identifier.", v)
+		}
+	}
+
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext(identifier, 1),
+		agents[1].NewCiphertext(otherIdentifier, 1),
+	}
+	if alarmsystem.TestIdentifier(it, ciphertexts) {
+		t.Fatal("Ciphertexts of another identifier are bound to the identifier.")
+	}
+
+	large, _ := testSetupKey.GenerateKeys(1, 16)
+	if _, err := large.NewIdentifierToken(); err != ErrMessageSpaceTooLarge {
+		t.Fatal("Expected ErrMessageSpaceTooLarge, got: ", err)
+	}
+}
+
+func TestSequenceIdentifier(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 8)
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	seq5 := []*Ciphertext{
+		agents[0].NewCiphertextSeq("window", 5, 16),
+		agents[1].NewCiphertextSeq("window", 5, 12),
+	}
+
+	alarmsystem := NewAlarmSystemSeq(testSetupKey.sp, ruletoken, "window", 5)
+	if !alarmsystem.Test(seq5) {
+		t.Fatal("No alarm was raised for the ciphertexts of sequence number 5.")
+	}
+
+	// Replay the ciphertexts of sequence number 5 in the evaluation of 6.
+	alarmsystem.SetSequence("window", 6)
+	if alarmsystem.Test(seq5) {
+		t.Fatal("Alarm was raised for replayed ciphertexts.")
+	}
+
+	// Ciphertexts with the plain base identifier do not match either.
+	plain := []*Ciphertext{
+		agents[0].NewCiphertext("window", 16),
+		agents[1].NewCiphertext("window", 12),
+	}
+	alarmsystem.SetSequence("window", 5)
+	if alarmsystem.Test(plain) {
+		t.Fatal("Alarm was raised for ciphertexts without sequence number.")
+	}
+}
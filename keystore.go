@@ -0,0 +1,206 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyStore persists the keys of a system. Agents and rule generators are
+// loaded for the system parameters they belong to, so the system parameters
+// have to be loaded first.
+type KeyStore interface {
+	SaveSystemParameters(sp *SystemParameters) error
+	LoadSystemParameters() (*SystemParameters, error)
+	SaveSetupKey(sk *SetupKey) error
+	LoadSetupKey(sp *SystemParameters) (*SetupKey, error)
+	SaveAgent(a *Agent) error
+	LoadAgent(sp *SystemParameters, index int) (*Agent, error)
+	SaveRuleGenerator(rg *RuleGenerator) error
+	LoadRuleGenerator(sp *SystemParameters) (*RuleGenerator, error)
+}
+
+// Manifest describes the contents of a FileKeyStore.
+type Manifest struct {
+	// Curve is the type of the pairing parameters, e.g. "a" or "f".
+	Curve string
+	// Agents is the number of agents known to the saved rule generator.
+	Agents int
+	// Names maps the names of agents to their indices in the saved rule
+	// generator.
+	Names map[string]int `json:",omitempty"`
+}
+
+// FileKeyStore is a KeyStore that stores every key in a separate file in a
+// directory, together with a manifest.json describing the system. The files
+// contain secret keys and are only readable by the owner.
+type FileKeyStore struct {
+	dir string
+}
+
+// NewFileKeyStore creates a key store in the directory dir. The directory is
+// created if it does not exist.
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileKeyStore{dir: dir}, nil
+}
+
+// SaveSystemParameters saves the system parameters and records their curve in
+// the manifest.
+func (ks *FileKeyStore) SaveSystemParameters(sp *SystemParameters) error {
+	data, err := sp.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := ks.write("params.bin", data); err != nil {
+		return err
+	}
+	return ks.updateManifest(func(m *Manifest) { m.Curve = curveType(sp.params) })
+}
+
+// LoadSystemParameters loads the saved system parameters.
+func (ks *FileKeyStore) LoadSystemParameters() (*SystemParameters, error) {
+	data, err := ks.read("params.bin")
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalSystemParameters(data)
+}
+
+// SaveSetupKey saves the setup key.
+func (ks *FileKeyStore) SaveSetupKey(sk *SetupKey) error {
+	data, err := sk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return ks.write("setupkey.bin", data)
+}
+
+// LoadSetupKey loads the saved setup key for the system parameters.
+func (ks *FileKeyStore) LoadSetupKey(sp *SystemParameters) (*SetupKey, error) {
+	data, err := ks.read("setupkey.bin")
+	if err != nil {
+		return nil, err
+	}
+	return sp.UnmarshalSetupKey(data)
+}
+
+// SaveAgent saves the keys of the agent under its index.
+func (ks *FileKeyStore) SaveAgent(a *Agent) error {
+	data, err := a.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return ks.write(agentFile(a.index), data)
+}
+
+// LoadAgent loads the agent with the given index for the system parameters.
+func (ks *FileKeyStore) LoadAgent(sp *SystemParameters, index int) (*Agent, error) {
+	data, err := ks.read(agentFile(index))
+	if err != nil {
+		return nil, err
+	}
+	a, err := sp.UnmarshalAgent(data)
+	if err != nil {
+		return nil, err
+	}
+	if a.index != index {
+		return nil, ErrMalformedData
+	}
+	return a, nil
+}
+
+// SaveRuleGenerator saves the rule generator, including the names of its
+// agents, and records its number of agents and the names in the manifest.
+func (ks *FileKeyStore) SaveRuleGenerator(rg *RuleGenerator) error {
+	data, err := rg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := ks.write("rulegenerator.bin", data); err != nil {
+		return err
+	}
+	return ks.updateManifest(func(m *Manifest) {
+		m.Agents = rg.NumAgents()
+		m.Names = nil
+		for _, name := range rg.AgentNames() {
+			if m.Names == nil {
+				m.Names = make(map[string]int)
+			}
+			m.Names[name], _ = rg.AgentIndex(name)
+		}
+	})
+}
+
+// LoadRuleGenerator loads the saved rule generator for the system parameters.
+func (ks *FileKeyStore) LoadRuleGenerator(sp *SystemParameters) (*RuleGenerator, error) {
+	data, err := ks.read("rulegenerator.bin")
+	if err != nil {
+		return nil, err
+	}
+	return sp.UnmarshalRuleGenerator(data)
+}
+
+// Manifest returns the manifest of the key store. An empty manifest is
+// returned if nothing has been saved yet.
+func (ks *FileKeyStore) Manifest() (Manifest, error) {
+	var m Manifest
+	data, err := ks.read("manifest.json")
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("Reading manifest: %w", err)
+	}
+	return m, nil
+}
+
+// updateManifest applies update to the manifest and writes it back.
+func (ks *FileKeyStore) updateManifest(update func(*Manifest)) error {
+	m, err := ks.Manifest()
+	if err != nil {
+		return err
+	}
+	update(&m)
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ks.write("manifest.json", data)
+}
+
+func (ks *FileKeyStore) write(name string, data []byte) error {
+	return os.WriteFile(filepath.Join(ks.dir, name), data, 0600)
+}
+
+func (ks *FileKeyStore) read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(ks.dir, name))
+}
+
+// agentFile returns the name of the file holding the agent with the index.
+func agentFile(index int) string {
+	return fmt.Sprintf("agent-%d.bin", index)
+}
+
+// curveType returns the type of pairing parameters, as given on their "type"
+// line.
+func curveType(params string) string {
+	for _, line := range strings.Split(params, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "type" {
+			return fields[1]
+		}
+	}
+	return ""
+}
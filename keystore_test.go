@@ -0,0 +1,85 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestFileKeyStore(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(5, 8)
+	if err := rulegenerator.SetAgentName(2, "site/door"); err != nil {
+		t.Fatal("Error naming agent: ", err)
+	}
+
+	ks, err := NewFileKeyStore(t.TempDir())
+	if err != nil {
+		t.Fatal("Error creating key store: ", err)
+	}
+	if err := ks.SaveSystemParameters(testSetupKey.sp); err != nil {
+		t.Fatal("Error saving system parameters: ", err)
+	}
+	if err := ks.SaveSetupKey(testSetupKey); err != nil {
+		t.Fatal("Error saving setup key: ", err)
+	}
+	for _, agent := range agents {
+		if err := ks.SaveAgent(agent); err != nil {
+			t.Fatal("Error saving agent: ", err)
+		}
+	}
+	if err := ks.SaveRuleGenerator(rulegenerator); err != nil {
+		t.Fatal("Error saving rule generator: ", err)
+	}
+
+	manifest, err := ks.Manifest()
+	if err != nil {
+		t.Fatal("Error reading manifest: ", err)
+	}
+	if manifest.Curve != "f" || manifest.Agents != 5 || len(manifest.Names) != 1 || manifest.Names["site/door"] != 2 {
+		t.Fatalf("Unexpected manifest %+v.", manifest)
+	}
+
+	sp, err := ks.LoadSystemParameters()
+	if err != nil {
+		t.Fatal("Error loading system parameters: ", err)
+	}
+	if err := sp.Compatible(testSetupKey.sp); err != nil {
+		t.Fatal("Loaded system parameters differ: ", err)
+	}
+	if _, err := ks.LoadSetupKey(sp); err != nil {
+		t.Fatal("Error loading setup key: ", err)
+	}
+	loadedAgents := make([]*Agent, len(agents))
+	for i := range loadedAgents {
+		if loadedAgents[i], err = ks.LoadAgent(sp, i); err != nil {
+			t.Fatal("Error loading agent: ", err)
+		}
+	}
+	loadedRulegenerator, err := ks.LoadRuleGenerator(sp)
+	if err != nil {
+		t.Fatal("Error loading rule generator: ", err)
+	}
+	if index, ok := loadedRulegenerator.AgentIndex("site/door"); !ok || index != 2 {
+		t.Fatalf("Got index %d for site/door after loading, expected 2.", index)
+	}
+
+	token, err := loadedRulegenerator.NewToken([]int32{3, -1, 7, -1, 200})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	plaintexts := []int32{3, 99, 7, 0, 200}
+	ciphertexts := make([]*Ciphertext, len(loadedAgents))
+	for i, agent := range loadedAgents {
+		ciphertexts[i] = agent.NewCiphertext("identifier", plaintexts[i])
+	}
+	if !NewAlarmSystem(sp, token, "identifier").Test(ciphertexts) {
+		t.Fatal("Token of the reloaded system did not match.")
+	}
+	plaintexts[2] = 8
+	ciphertexts[2] = loadedAgents[2].NewCiphertext("identifier", plaintexts[2])
+	if NewAlarmSystem(sp, token, "identifier").Test(ciphertexts) {
+		t.Fatal("Token of the reloaded system matched a different plaintext.")
+	}
+
+	if _, err := ks.LoadAgent(sp, 5); err == nil {
+		t.Fatal("Loaded an agent that was never saved.")
+	}
+}
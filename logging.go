@@ -0,0 +1,69 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+)
+
+// WithLogger registers a logger for security-relevant events of the system
+// parameters: issued tokens, revoked agents, rejected encodings and
+// mismatching parameters. Without a logger, nothing is logged. Only
+// fingerprints, indices and reasons are logged, never keys, token elements or
+// plaintexts.
+func WithLogger(logger *slog.Logger) Option {
+	return func(sp *SystemParameters) {
+		sp.logger = logger
+	}
+}
+
+// logEnabled reports whether events of the level are logged, so the
+// attributes of an event are only computed if it is.
+func (sp *SystemParameters) logEnabled(level slog.Level) bool {
+	return sp.logger != nil && sp.logger.Enabled(context.Background(), level)
+}
+
+// logTokenIssued logs that a token has been issued.
+func (sp *SystemParameters) logTokenIssued(rt *RuleToken) {
+	if !sp.logEnabled(slog.LevelInfo) {
+		return
+	}
+	fingerprint := rt.Fingerprint()
+	covered, _ := rt.Coverage()
+	sp.logger.Info("token issued", "fingerprint", hex.EncodeToString(fingerprint[:]), "agents", covered)
+}
+
+// logAgentsRevoked logs that the agents with the indices have been revoked,
+// or that all revocations have been cleared if there are no indices.
+func (sp *SystemParameters) logAgentsRevoked(indices []int) {
+	if !sp.logEnabled(slog.LevelInfo) {
+		return
+	}
+	if len(indices) == 0 {
+		sp.logger.Info("revocations cleared")
+		return
+	}
+	sp.logger.Info("agents revoked", "agents", indices)
+}
+
+// logDecodeRejected logs that serialized data was rejected.
+func (sp *SystemParameters) logDecodeRejected(err error) {
+	if !sp.logEnabled(slog.LevelWarn) {
+		return
+	}
+	sp.logger.Warn("decode rejected", "reason", err.Error())
+}
+
+// logParameterMismatch logs that two sets of system parameters were found to
+// be incompatible.
+func (sp *SystemParameters) logParameterMismatch(err error) {
+	if !sp.logEnabled(slog.LevelWarn) {
+		return
+	}
+	sp.logger.Warn("parameter mismatch", "reason", err.Error())
+}
@@ -0,0 +1,82 @@
+package crypmonsys
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	sp := NewSystemParameters(testSetupKey.sp.pairing, WithLogger(logger))
+	rulegenerator, agents := NewSetupKey(sp).GenerateKeys(3, 8)
+
+	var tokens []*RuleToken
+	for _, rule := range [][]int32{{16, -1, 12}, {16, 42, 12}} {
+		ruletoken, err := rulegenerator.NewToken(rule)
+		if err != nil {
+			t.Fatal("Error creating token: ", err)
+		}
+		tokens = append(tokens, ruletoken)
+	}
+	tokens = append(tokens, rulegenerator.NewWildcardToken())
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 12),
+	}
+	if !NewAlarmSystem(sp, tokens[0], "identifier").Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+	if _, err := sp.UnmarshalCiphertext([]byte{tagCiphertext}); err == nil {
+		t.Fatal("Decoded a truncated ciphertext.")
+	}
+	if sp.Compatible(NewSystemParameters(sp.pairing)) == nil {
+		t.Fatal("Systems with random generators are compatible.")
+	}
+	alarmsystem := NewAlarmSystem(sp, tokens[0], "identifier")
+	alarmsystem.SetRevoked(1)
+	alarmsystem.SetRevoked()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := map[string]int{"token issued": 3, "decode rejected": 1, "parameter mismatch": 1, "agents revoked": 1, "revocations cleared": 1}
+	for _, line := range lines {
+		for msg := range expected {
+			if strings.Contains(line, `"msg":"`+msg+`"`) {
+				expected[msg]--
+			}
+		}
+	}
+	if len(lines) != 7 {
+		t.Fatalf("Got %d events, expected 7:\n%s", len(lines), buf.String())
+	}
+	for msg, missing := range expected {
+		if missing != 0 {
+			t.Fatalf("Got %d fewer %q events than expected:\n%s", missing, msg, buf.String())
+		}
+	}
+
+	// No key, token element or ciphertext may end up in the log.
+	log := buf.String()
+	var secrets [][]byte
+	for i, agent := range agents {
+		secrets = append(secrets, agent.gamma.Bytes(), agent.g1alpha.Bytes(), ciphertexts[i].part2.Bytes())
+		for _, beta := range agent.beta {
+			secrets = append(secrets, beta.Bytes())
+		}
+	}
+	for _, rt := range tokens {
+		secrets = append(secrets, rt.product.Bytes())
+		for i := range rt.indices {
+			secrets = append(secrets, rt.g2u[i].Bytes(), rt.f2u[i].Bytes())
+		}
+	}
+	for _, secret := range secrets {
+		if strings.Contains(log, hex.EncodeToString(secret)) || strings.Contains(log, string(secret)) {
+			t.Fatal("Log contains secret material.")
+		}
+	}
+}
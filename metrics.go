@@ -0,0 +1,77 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"sync/atomic"
+)
+
+// Metrics collects counters from the hot paths of the scheme. A collector is
+// registered on the SystemParameters with SetMetrics and is called by every
+// ciphertext, token and test derived from those parameters. Implementations
+// must be safe for concurrent use.
+type Metrics interface {
+	// ObservePairings is called with the number of pairings computed.
+	ObservePairings(n int)
+	// IncCiphertexts is called for every ciphertext created.
+	IncCiphertexts()
+	// IncTokens is called for every rule token created.
+	IncTokens()
+	// IncTests is called for every test of a token against ciphertexts.
+	IncTests()
+	// IncDropped is called for every window an Evaluator drops because its
+	// queue is full.
+	IncDropped()
+}
+
+// nopMetrics is the collector used when no collector is registered.
+type nopMetrics struct{}
+
+func (nopMetrics) ObservePairings(n int) {}
+func (nopMetrics) IncCiphertexts()       {}
+func (nopMetrics) IncTokens()            {}
+func (nopMetrics) IncTests()             {}
+func (nopMetrics) IncDropped()           {}
+
+// SetMetrics registers a collector for the system parameters. Passing nil
+// disables the collection again. The collector should be registered before the
+// system parameters are used.
+func (sp *SystemParameters) SetMetrics(m Metrics) {
+	sp.metrics = m
+}
+
+// collector returns the registered collector, or a no-op collector if none is
+// registered.
+func (sp *SystemParameters) collector() Metrics {
+	if sp.metrics == nil {
+		return nopMetrics{}
+	}
+	return sp.metrics
+}
+
+// CountingMetrics is a Metrics implementation that keeps atomic counters.
+type CountingMetrics struct {
+	Pairings    atomic.Int64
+	Ciphertexts atomic.Int64
+	Tokens      atomic.Int64
+	Tests       atomic.Int64
+	Dropped     atomic.Int64
+}
+
+// ObservePairings adds n to the number of pairings.
+func (m *CountingMetrics) ObservePairings(n int) { m.Pairings.Add(int64(n)) }
+
+// IncCiphertexts increments the number of ciphertexts.
+func (m *CountingMetrics) IncCiphertexts() { m.Ciphertexts.Add(1) }
+
+// IncTokens increments the number of tokens.
+func (m *CountingMetrics) IncTokens() { m.Tokens.Add(1) }
+
+// IncTests increments the number of tests.
+func (m *CountingMetrics) IncTests() { m.Tests.Add(1) }
+
+// IncDropped increments the number of dropped windows.
+func (m *CountingMetrics) IncDropped() { m.Dropped.Add(1) }
@@ -0,0 +1,44 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	sp := NewSystemParameters(testSetupKey.sp.pairing)
+	metrics := &CountingMetrics{}
+	sp.SetMetrics(metrics)
+
+	rulegenerator, agents := NewSetupKey(sp).GenerateKeys(3, 8)
+
+	identifier := "identifier"
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	ciphertexts := make([]*Ciphertext, len(agents))
+	ciphertexts[0] = agents[0].NewCiphertext(identifier, 16)
+	ciphertexts[1] = agents[1].NewCiphertext(identifier, 42)
+	ciphertexts[2] = agents[2].NewCiphertext(identifier, 12)
+
+	alarmsystem := NewAlarmSystem(sp, ruletoken, identifier)
+	for i := 0; i < 4; i++ {
+		alarmsystem.Test(ciphertexts)
+	}
+
+	if n := metrics.Ciphertexts.Load(); n != 3 {
+		t.Fatalf("Counted %d ciphertexts, expected 3.", n)
+	}
+	if n := metrics.Tokens.Load(); n != 1 {
+		t.Fatalf("Counted %d tokens, expected 1.", n)
+	}
+	if n := metrics.Tests.Load(); n != 4 {
+		t.Fatalf("Counted %d tests, expected 4.", n)
+	}
+	// Every test pairs two elements per pinned agent plus the identifier.
+	if n := metrics.Pairings.Load(); n != 4*5 {
+		t.Fatalf("Counted %d pairings, expected %d.", n, 4*5)
+	}
+}
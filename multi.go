@@ -0,0 +1,101 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"crypto/sha256"
+	"errors"
+	"github.com/Nik-U/pbc"
+)
+
+// ErrRuleCountMismatch is an error that is issued when the number of rules
+// passed to Evaluate differs from the number of tokens of the alarm system.
+var ErrRuleCountMismatch = errors.New("Number of rules does not match the number of tokens.")
+
+// AlarmSystemMulti represents an alarm system that tests a set of tokens
+// against the same ciphertexts. The hash of the identifier is preprocessed for
+// pairing once per identifier, which makes evaluating many tokens cheaper than
+// using an AlarmSystem per token.
+//
+// The ciphertexts are deliberately not preprocessed for pairing. Each token
+// is tested with two products of pairings, which share a single final
+// exponentiation per product. pbc can only pair a preprocessed element on its
+// own, with a final exponentiation per pairing, which costs more than the
+// preprocessing saves, even when many tokens share the ciphertexts.
+type AlarmSystemMulti struct {
+	sp        *SystemParameters
+	tokens    []*RuleToken
+	hID       *pbc.Element
+	hIDPairer *pbc.Pairer
+}
+
+// NewAlarmSystemMulti creates a new alarm system for a set of tokens.
+func NewAlarmSystemMulti(sp *SystemParameters, tokens []*RuleToken, identifier string) *AlarmSystemMulti {
+	as := &AlarmSystemMulti{
+		sp:     sp,
+		tokens: append([]*RuleToken(nil), tokens...),
+		hID:    sp.pairing.NewG1(),
+	}
+	as.SetIdentifier(identifier)
+	return as
+}
+
+// SetIdentifier binds the alarm system to a new identifier and rebuilds the
+// pairing preprocessing of its hash.
+func (as *AlarmSystemMulti) SetIdentifier(identifier string) {
+	as.hID.SetFromStringHash(identifier, sha256.New())
+	as.hIDPairer = as.hID.PreparePairer()
+}
+
+// EvaluateAll tests the provided ciphertexts against every token of the alarm
+// system. The i-th result reports whether the i-th token matched; malformed
+// tokens never match.
+func (as *AlarmSystemMulti) EvaluateAll(ct []*Ciphertext) []bool {
+	results := make([]bool, len(as.tokens))
+	for i, rt := range as.tokens {
+		if rt.check() != nil {
+			continue
+		}
+		idFactor := as.sp.pairing.NewGT().PairerPair(as.hIDPairer, rt.product)
+		results[i] = as.sp.test(rt, idFactor, ct)
+	}
+	return results
+}
+
+// TestAny tests the provided ciphertexts against the tokens of the alarm
+// system and reports whether any of them matched. It stops at the first
+// matching token, which makes it suitable for the alternatives of a rule, as
+// generated by NewTokenWithNegations.
+func (as *AlarmSystemMulti) TestAny(ct []*Ciphertext) bool {
+	for _, rt := range as.tokens {
+		if rt.check() != nil {
+			continue
+		}
+		idFactor := as.sp.pairing.NewGT().PairerPair(as.hIDPairer, rt.product)
+		if as.sp.test(rt, idFactor, ct) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate tests the provided ciphertexts against every token of the alarm
+// system and returns the rules whose token matched, in order. The i-th rule
+// belongs to the i-th token of the alarm system. It returns
+// ErrRuleCountMismatch if the number of rules differs from the number of
+// tokens.
+func Evaluate[T any](as *AlarmSystemMulti, ct []*Ciphertext, rules []T) ([]T, error) {
+	if len(rules) != len(as.tokens) {
+		return nil, ErrRuleCountMismatch
+	}
+	var matched []T
+	for i, result := range as.EvaluateAll(ct) {
+		if result {
+			matched = append(matched, rules[i])
+		}
+	}
+	return matched, nil
+}
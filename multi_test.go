@@ -0,0 +1,162 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestEvaluateAll(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	identifier := "identifier"
+	otherIdentifier := "some other identifier"
+
+	rules := [][]int32{
+		{16, -1, 12},
+		{16, 42, -1},
+		{14, -1, 12},
+	}
+	tokens := make([]*RuleToken, len(rules))
+	for i, rule := range rules {
+		var err error
+		if tokens[i], err = rulegenerator.NewToken(rule); err != nil {
+			t.Fatal("Error creating token: ", err)
+		}
+	}
+
+	ciphertexts := func(identifier string) []*Ciphertext {
+		return []*Ciphertext{
+			agents[0].NewCiphertext(identifier, 16),
+			agents[1].NewCiphertext(identifier, 42),
+			agents[2].NewCiphertext(identifier, 12),
+		}
+	}
+
+	alarmsystem := NewAlarmSystemMulti(testSetupKey.sp, tokens, identifier)
+	expected := []bool{true, true, false}
+	for i, result := range alarmsystem.EvaluateAll(ciphertexts(identifier)) {
+		if result != expected[i] {
+			t.Fatalf("Token %d: got %v, expected %v.", i, result, expected[i])
+		}
+	}
+
+	alarmsystem.SetIdentifier(otherIdentifier)
+	expected = []bool{true, true, false}
+	for i, result := range alarmsystem.EvaluateAll(ciphertexts(otherIdentifier)) {
+		if result != expected[i] {
+			t.Fatalf("Token %d after SetIdentifier: got %v, expected %v.", i, result, expected[i])
+		}
+	}
+	for i, result := range alarmsystem.EvaluateAll(ciphertexts(identifier)) {
+		if result {
+			t.Fatalf("Token %d matched ciphertexts of the old identifier.", i)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	type rule struct {
+		name   string
+		values []int32
+	}
+	rules := []rule{
+		{"first", []int32{16, -1, 12}},
+		{"second", []int32{14, -1, 12}},
+		{"third", []int32{16, 42, -1}},
+	}
+	tokens := make([]*RuleToken, len(rules))
+	for i, r := range rules {
+		var err error
+		if tokens[i], err = rulegenerator.NewToken(r.values); err != nil {
+			t.Fatal("Error creating token: ", err)
+		}
+	}
+
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 12),
+	}
+	alarmsystem := NewAlarmSystemMulti(testSetupKey.sp, tokens, "identifier")
+	matched, err := Evaluate(alarmsystem, ciphertexts, rules)
+	if err != nil {
+		t.Fatal("Error evaluating rules: ", err)
+	}
+	if len(matched) != 2 || matched[0].name != "first" || matched[1].name != "third" {
+		t.Fatalf("Unexpected matched rules %v.", matched)
+	}
+
+	if _, err := Evaluate(alarmsystem, ciphertexts, rules[:2]); err != ErrRuleCountMismatch {
+		t.Fatal("Expected ErrRuleCountMismatch, got: ", err)
+	}
+}
+
+func benchmarkTokens(b *testing.B, numTokens int) ([]*RuleToken, []*Ciphertext) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	tokens := make([]*RuleToken, numTokens)
+	for i := range tokens {
+		var err error
+		if tokens[i], err = rulegenerator.NewToken([]int32{int32(i % 256), -1, 12}); err != nil {
+			b.Fatal("Error creating token: ", err)
+		}
+	}
+
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, agent := range agents {
+		ciphertexts[i] = agent.NewCiphertext("identifier", 12)
+	}
+	return tokens, ciphertexts
+}
+
+func BenchmarkTest50TokensSeparate(b *testing.B) {
+	tokens, ciphertexts := benchmarkTokens(b, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, token := range tokens {
+			NewAlarmSystem(testSetupKey.sp, token, "identifier").Test(ciphertexts)
+		}
+	}
+}
+
+func BenchmarkTest50TokensMulti(b *testing.B) {
+	tokens, ciphertexts := benchmarkTokens(b, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewAlarmSystemMulti(testSetupKey.sp, tokens, "identifier").EvaluateAll(ciphertexts)
+	}
+}
+
+func BenchmarkEvaluate100Tokens16Agents(b *testing.B) {
+	tokens, ciphertexts := benchmarkTokens16(b, 100)
+	alarmsystem := NewAlarmSystemMulti(testSetupKey.sp, tokens, "identifier")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		alarmsystem.EvaluateAll(ciphertexts)
+	}
+}
+
+// benchmarkTokens16 returns tokens that pin every agent of 16 agents, and a
+// set of ciphertexts of those agents.
+func benchmarkTokens16(b *testing.B, numTokens int) ([]*RuleToken, []*Ciphertext) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(16, 8)
+
+	tokens := make([]*RuleToken, numTokens)
+	rule := make([]int32, len(agents))
+	for i := range tokens {
+		for j := range rule {
+			rule[j] = int32((i + j) % 256)
+		}
+		var err error
+		if tokens[i], err = rulegenerator.NewToken(rule); err != nil {
+			b.Fatal("Error creating token: ", err)
+		}
+	}
+
+	ciphertexts := make([]*Ciphertext, len(agents))
+	for i, agent := range agents {
+		ciphertexts[i] = agent.NewCiphertext("identifier", int32(i))
+	}
+	return tokens, ciphertexts
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrDuplicateName is an error that is issued when a name is assigned to
+	// more than one agent.
+	ErrDuplicateName = errors.New("Name is already assigned to another agent.")
+
+	// ErrUnknownAgentName is an error that is issued when a name is not
+	// assigned to any agent.
+	ErrUnknownAgentName = errors.New("Name is not assigned to any agent.")
+
+	// ErrInvalidAgentName is an error that is issued when a namespace or a
+	// name contains the separator "/".
+	ErrInvalidAgentName = errors.New("Namespace or name of an agent contains \"/\".")
+)
+
+// AgentName returns the name of an agent in a namespace, such as
+// "building-A/door-3". Namespaces keep names unique when the agents of several
+// subsystems are combined in one rule generator. It returns
+// ErrInvalidAgentName if the namespace or the name contains "/", as the names
+// would otherwise be ambiguous.
+func AgentName(namespace, name string) (string, error) {
+	if strings.Contains(namespace, "/") || strings.Contains(name, "/") {
+		return "", ErrInvalidAgentName
+	}
+	return namespace + "/" + name, nil
+}
+
+// SetAgentName assigns a name to the agent with the given index, so rules can
+// refer to the agent by name with NewTokenFromNames. An agent may have several
+// names. The index an agent has in the rule generator never changes, so a
+// name keeps referring to the same agent. It returns ErrInvalidAgentIndex if
+// the agent is not known and ErrDuplicateName if the name is already assigned
+// to another agent.
+func (rg *RuleGenerator) SetAgentName(index int, name string) error {
+	if index < 0 || index >= len(rg.agents) {
+		return ErrInvalidAgentIndex
+	}
+	if i, ok := rg.names[name]; ok && i != index {
+		return ErrDuplicateName
+	}
+	if rg.names == nil {
+		rg.names = make(map[string]int)
+	}
+	rg.names[name] = index
+	return nil
+}
+
+// AgentNames returns all names assigned to agents, in ascending order.
+func (rg *RuleGenerator) AgentNames() []string {
+	names := make([]string, 0, len(rg.names))
+	for name := range rg.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AgentIndex returns the index of the agent with the given name.
+func (rg *RuleGenerator) AgentIndex(name string) (int, bool) {
+	i, ok := rg.names[name]
+	return i, ok
+}
+
+// NewTokenFromNames generates a new rule token from a map of agent names to
+// rule values. Agents that are absent from the map are wildcards. It returns
+// ErrUnknownAgentName if a name is not assigned to an agent, and
+// ErrDuplicateConstraint if two names refer to the same agent.
+func (rg *RuleGenerator) NewTokenFromNames(constraints map[string]int32) (*RuleToken, error) {
+	byIndex := make(map[int]int32, len(constraints))
+	for name, v := range constraints {
+		i, ok := rg.names[name]
+		if !ok {
+			return nil, ErrUnknownAgentName
+		}
+		if _, ok := byIndex[i]; ok {
+			return nil, ErrDuplicateConstraint
+		}
+		byIndex[i] = v
+	}
+	return rg.NewTokenFromMap(byIndex)
+}
@@ -0,0 +1,122 @@
+package crypmonsys
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestTokenFromNames(t *testing.T) {
+	sp := testSetupKey.sp
+
+	// Two subsystems that were set up independently are merged.
+	rulegeneratorA, agentsA := testSetupKey.GenerateKeys(2, 8)
+	rulegeneratorB, agentsB := testSetupKey.GenerateKeys(3, 8)
+	var infos []AgentInfo
+	for _, info := range rulegeneratorA.Agents() {
+		infos = append(infos, info)
+	}
+	for _, info := range rulegeneratorB.Agents() {
+		infos = append(infos, info)
+	}
+	rulegenerator := NewRuleGenerator(sp, infos)
+	for i := range agentsA {
+		name, err := AgentName("building-A", fmt.Sprintf("door-%d", i))
+		if err != nil {
+			t.Fatal("Error creating name: ", err)
+		}
+		if err := rulegenerator.SetAgentName(i, name); err != nil {
+			t.Fatal("Error naming agent: ", err)
+		}
+	}
+	for i := range agentsB {
+		name, err := AgentName("building-B", fmt.Sprintf("door-%d", i))
+		if err != nil {
+			t.Fatal("Error creating name: ", err)
+		}
+		if err := rulegenerator.SetAgentName(len(agentsA)+i, name); err != nil {
+			t.Fatal("Error naming agent: ", err)
+		}
+	}
+	if err := rulegenerator.SetAgentName(0, "building-B/door-0"); err != ErrDuplicateName {
+		t.Fatal("Expected ErrDuplicateName, got: ", err)
+	}
+	if index, ok := rulegenerator.AgentIndex("building-B/door-0"); !ok || index != 2 {
+		t.Fatalf("Got index %d for building-B/door-0, expected 2.", index)
+	}
+
+	ruletoken, err := rulegenerator.NewTokenFromNames(map[string]int32{
+		"building-A/door-1": 16,
+		"building-B/door-0": 12,
+	})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	if covered, _ := ruletoken.Coverage(); len(covered) != 2 || covered[0] != 1 || covered[1] != 2 {
+		t.Fatalf("Token covers %v, expected [1 2].", covered)
+	}
+
+	ciphertexts := []*Ciphertext{
+		agentsA[0].NewCiphertext("identifier", 12),
+		agentsA[1].NewCiphertext("identifier", 16),
+		agentsB[0].NewCiphertext("identifier", 12),
+		agentsB[1].NewCiphertext("identifier", 16),
+		agentsB[2].NewCiphertext("identifier", 0),
+	}
+	if !NewAlarmSystem(sp, ruletoken, "identifier").Test(ciphertexts) {
+		t.Fatal("No alarm was raised, whereas an alarm should have been raised.")
+	}
+	ciphertexts[0], ciphertexts[1] = ciphertexts[1], ciphertexts[0]
+	if NewAlarmSystem(sp, ruletoken, "identifier").Test(ciphertexts) {
+		t.Fatal("Token matched ciphertexts at the wrong positions.")
+	}
+
+	if _, err := rulegenerator.NewTokenFromNames(map[string]int32{"building-C/door-0": 1}); err != ErrUnknownAgentName {
+		t.Fatal("Expected ErrUnknownAgentName, got: ", err)
+	}
+}
+
+func TestAgentNameSeparator(t *testing.T) {
+	for _, parts := range [][2]string{{"a/b", "c"}, {"a", "b/c"}} {
+		if _, err := AgentName(parts[0], parts[1]); err != ErrInvalidAgentName {
+			t.Fatalf("Expected ErrInvalidAgentName for %q and %q, got: %v", parts[0], parts[1], err)
+		}
+	}
+}
+
+func TestAgentNamesRoundTrip(t *testing.T) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(3, 8)
+	for i, name := range []string{"site/door", "site/window", "site/motion"} {
+		if err := rulegenerator.SetAgentName(i, name); err != nil {
+			t.Fatal("Error naming agent: ", err)
+		}
+	}
+	if err := rulegenerator.SetAgentName(0, "site/front-door"); err != nil {
+		t.Fatal("Error naming agent: ", err)
+	}
+
+	data, err := rulegenerator.MarshalBinary()
+	if err != nil {
+		t.Fatal("Error marshaling rule generator: ", err)
+	}
+	decoded, err := testSetupKey.sp.UnmarshalRuleGenerator(data)
+	if err != nil {
+		t.Fatal("Error unmarshaling rule generator: ", err)
+	}
+	names := decoded.AgentNames()
+	if len(names) != 4 {
+		t.Fatalf("Decoded names %v, expected 4 names.", names)
+	}
+	for _, name := range names {
+		if i, _ := decoded.AgentIndex(name); i != rulegenerator.names[name] {
+			t.Fatalf("Decoded index %d for %s, expected %d.", i, name, rulegenerator.names[name])
+		}
+	}
+	encoded, err := decoded.MarshalBinary()
+	if err != nil {
+		t.Fatal("Error marshaling decoded rule generator: ", err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Fatal("Decoded rule generator does not encode to its input.")
+	}
+}
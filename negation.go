@@ -0,0 +1,89 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"errors"
+)
+
+// MaxAlternatives is the largest number of tokens NewTokenWithNegations
+// generates for a single rule.
+const MaxAlternatives = 256
+
+// ErrTooManyAlternatives is an error that is issued when expanding the
+// negations of a rule takes more than MaxAlternatives tokens.
+var ErrTooManyAlternatives = errors.New("Negations expand to too many tokens.")
+
+// Constraint constrains the value of a single agent. If Negate is set, the
+// agent must not have Value, otherwise it must have Value.
+type Constraint struct {
+	Value  int32
+	Negate bool
+}
+
+// NewTokenWithNegations generates tokens for a rule that may contain negated
+// constraints. Agents absent from the map are wildcards. The scheme can only
+// test equality, so a negated constraint is expanded into one alternative for
+// every other value in the message space of the agent, and the rule matches
+// if any of the returned tokens matches, e.g. with AlarmSystemMulti.TestAny.
+//
+// The number of tokens is the product of the sizes of the message spaces of
+// the negated agents, minus one each, so negations are only practical for
+// small message spaces. ErrTooManyAlternatives is returned if more than
+// MaxAlternatives tokens would be needed.
+func (rg *RuleGenerator) NewTokenWithNegations(constraints map[int]Constraint) ([]*RuleToken, error) {
+	base := make([]int32, len(rg.agents))
+	for i := range base {
+		base[i] = Wildcard
+	}
+	var negated []int
+	alternatives := 1
+	for i, c := range constraints {
+		if i < 0 || i >= len(base) {
+			return nil, ErrInvalidAgentIndex
+		}
+		max := MaxMessage(len(rg.agents[i].beta))
+		if c.Value < 0 || int64(c.Value) > max {
+			return nil, ErrRuleValueOutOfRange
+		}
+		base[i] = c.Value
+		if c.Negate {
+			// Every value but c.Value remains.
+			if max > MaxAlternatives || alternatives*int(max) > MaxAlternatives {
+				return nil, ErrTooManyAlternatives
+			}
+			alternatives *= int(max)
+			negated = append(negated, i)
+		}
+	}
+
+	// Enumerate the combinations of values of the negated agents.
+	rules := [][]int32{base}
+	for _, i := range negated {
+		excluded := base[i]
+		var expanded [][]int32
+		for _, rule := range rules {
+			for v := int32(0); int64(v) <= MaxMessage(len(rg.agents[i].beta)); v++ {
+				if v == excluded {
+					continue
+				}
+				alternative := append([]int32(nil), rule...)
+				alternative[i] = v
+				expanded = append(expanded, alternative)
+			}
+		}
+		rules = expanded
+	}
+
+	tokens := make([]*RuleToken, len(rules))
+	for j, rule := range rules {
+		var err error
+		if tokens[j], err = rg.NewToken(rule); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,44 @@
+package crypmonsys
+
+import (
+	"testing"
+)
+
+func TestTokenWithNegations(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(2, 2)
+
+	// Agent 1 is not 3, agent 0 is 2.
+	tokens, err := rulegenerator.NewTokenWithNegations(map[int]Constraint{
+		0: {Value: 2},
+		1: {Value: 3, Negate: true},
+	})
+	if err != nil {
+		t.Fatal("Error creating tokens: ", err)
+	}
+	if len(tokens) != 3 {
+		t.Fatalf("Got %d tokens, expected 3.", len(tokens))
+	}
+
+	alarmsystem := NewAlarmSystemMulti(testSetupKey.sp, tokens, "identifier")
+	for v := int32(0); v < 4; v++ {
+		ciphertexts := []*Ciphertext{
+			agents[0].NewCiphertext("identifier", 2),
+			agents[1].NewCiphertext("identifier", v),
+		}
+		if alarmsystem.TestAny(ciphertexts) != (v != 3) {
+			t.Fatalf("Unexpected result for value %d of the negated agent.", v)
+		}
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 1),
+		agents[1].NewCiphertext("identifier", 0),
+	}
+	if alarmsystem.TestAny(ciphertexts) {
+		t.Fatal("Tokens matched a different value of the pinned agent.")
+	}
+
+	rulegenerator, _ = testSetupKey.GenerateKeys(1, 9)
+	if _, err := rulegenerator.NewTokenWithNegations(map[int]Constraint{0: {Value: 3, Negate: true}}); err != ErrTooManyAlternatives {
+		t.Fatal("Expected ErrTooManyAlternatives for a 9-bit space, got: ", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"sync"
+)
+
+// AlarmSystemPool is a pool of alarm systems for a fixed token. It reduces the
+// allocations of servers that evaluate the same token for many identifiers
+// concurrently. Every pooled alarm system owns its own hash of the identifier,
+// so alarm systems obtained from the pool can be used concurrently.
+type AlarmSystemPool struct {
+	sp   *SystemParameters
+	rt   *RuleToken
+	pool sync.Pool
+}
+
+// NewAlarmSystemPool creates a new pool of alarm systems for the token.
+func NewAlarmSystemPool(sp *SystemParameters, rt *RuleToken) *AlarmSystemPool {
+	p := &AlarmSystemPool{sp: sp, rt: rt}
+	p.pool.New = func() any {
+		return &AlarmSystem{sp: sp, rt: rt, hID: sp.pairing.NewG1()}
+	}
+	return p
+}
+
+// Get returns an alarm system from the pool that is bound to identifier, with
+// no agents revoked.
+func (p *AlarmSystemPool) Get(identifier string) *AlarmSystem {
+	as := p.pool.Get().(*AlarmSystem)
+	as.SetIdentifier(identifier)
+	as.revoked = nil
+	return as
+}
+
+// Put returns an alarm system to the pool. The alarm system should not be used
+// afterwards. Alarm systems for a different token are not added to the pool.
+func (p *AlarmSystemPool) Put(as *AlarmSystem) {
+	if as == nil || as.rt != p.rt || as.sp != p.sp {
+		return
+	}
+	p.pool.Put(as)
+}
@@ -0,0 +1,93 @@
+package crypmonsys
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestAlarmSystemPool(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	pool := NewAlarmSystemPool(testSetupKey.sp, ruletoken)
+
+	windows := make([][]*Ciphertext, 8)
+	for w := range windows {
+		identifier := fmt.Sprintf("window-%d", w)
+		windows[w] = []*Ciphertext{
+			agents[0].NewCiphertext(identifier, 16),
+			agents[1].NewCiphertext(identifier, 42),
+			agents[2].NewCiphertext(identifier, 12),
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, len(windows))
+	for w := range windows {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				alarmsystem := pool.Get(fmt.Sprintf("window-%d", w))
+				if !alarmsystem.Test(windows[w]) {
+					errs <- fmt.Sprintf("No alarm was raised for window %d.", w)
+				}
+				if alarmsystem.Test(windows[(w+1)%len(windows)]) {
+					errs <- fmt.Sprintf("Alarm was raised for a different window than %d.", w)
+				}
+				pool.Put(alarmsystem)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// benchmarkAlarmSystemParallel measures concurrent evaluations, where source
+// provides the functions to obtain and release an alarm system for the token.
+func benchmarkAlarmSystemParallel(b *testing.B, source func(rt *RuleToken) (get func(string) *AlarmSystem, put func(*AlarmSystem))) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		b.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 12),
+	}
+	get, put := source(ruletoken)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			alarmsystem := get("identifier")
+			alarmsystem.Test(ciphertexts)
+			put(alarmsystem)
+		}
+	})
+}
+
+func BenchmarkAlarmSystemNewParallel(b *testing.B) {
+	benchmarkAlarmSystemParallel(b, func(rt *RuleToken) (func(string) *AlarmSystem, func(*AlarmSystem)) {
+		get := func(identifier string) *AlarmSystem {
+			return NewAlarmSystem(testSetupKey.sp, rt, identifier)
+		}
+		return get, func(*AlarmSystem) {}
+	})
+}
+
+func BenchmarkAlarmSystemPoolParallel(b *testing.B) {
+	benchmarkAlarmSystemParallel(b, func(rt *RuleToken) (func(string) *AlarmSystem, func(*AlarmSystem)) {
+		pool := NewAlarmSystemPool(testSetupKey.sp, rt)
+		return pool.Get, pool.Put
+	})
+}
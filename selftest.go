@@ -0,0 +1,176 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyMismatch is an error that is issued when the keys of an agent do not
+// match the information the rule generator holds about it.
+var ErrKeyMismatch = errors.New("Agent keys do not match the agent information")
+
+// ErrSelfTestFailed is an error that is issued when SelfTest finds the system
+// parameters, the agents and the rule generator to be inconsistent.
+var ErrSelfTestFailed = errors.New("Self-test failed")
+
+// SelfTest checks that the system parameters, the agents and the rule
+// generator are consistent with each other. It encrypts a value for every agent
+// under a fresh random identifier and verifies that a fully pinned token and an
+// all-wildcard token match, while a token for a different value and ciphertexts
+// for a different identifier do not. The returned error wraps ErrSelfTestFailed
+// and describes the first check that failed. SelfTest can be used as a startup probe after loading keys.
+func (sp *SystemParameters) SelfTest(agents []*Agent, rg *RuleGenerator) (err error) {
+	if err := sp.checkOpen(); err != nil {
+		return err
+	}
+	if len(agents) != len(rg.agents) {
+		return fmt.Errorf("%w: %d agents supplied, but the rule generator knows %d agents", ErrSelfTestFailed, len(agents), len(rg.agents))
+	}
+	for i, agent := range agents {
+		if agent.index != i {
+			return fmt.Errorf("%w: agent at position %d has index %d", ErrSelfTestFailed, i, agent.index)
+		}
+	}
+
+	// Mixing elements of different pairings makes pbc panic, report this as a
+	// failure instead.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrSelfTestFailed, r)
+		}
+	}()
+
+	identifier, err := randomIdentifier()
+	if err != nil {
+		return err
+	}
+	otherIdentifier, err := randomIdentifier()
+	if err != nil {
+		return err
+	}
+
+	// Every agent encrypts the value 1, which fits in any message space.
+	pinned := make([]int32, len(agents))
+	wildcards := make([]int32, len(agents))
+	ciphertexts := make([]*Ciphertext, len(agents))
+	otherCiphertexts := make([]*Ciphertext, len(agents))
+	for i, agent := range agents {
+		pinned[i] = 1
+		wildcards[i] = -1
+		ciphertexts[i] = agent.NewCiphertext(identifier, 1)
+		otherCiphertexts[i] = agent.NewCiphertext(otherIdentifier, 1)
+	}
+
+	pinnedToken, err := rg.NewToken(pinned)
+	if err != nil {
+		return fmt.Errorf("%w: creating pinned token: %v", ErrSelfTestFailed, err)
+	}
+	if !NewAlarmSystem(sp, pinnedToken, identifier).Test(ciphertexts) {
+		return fmt.Errorf("%w: fully pinned token does not match", ErrSelfTestFailed)
+	}
+	if NewAlarmSystem(sp, pinnedToken, identifier).Test(otherCiphertexts) {
+		return fmt.Errorf("%w: token matches ciphertexts of another identifier", ErrSelfTestFailed)
+	}
+
+	wildcardToken, err := rg.NewToken(wildcards)
+	if err != nil {
+		return fmt.Errorf("%w: creating wildcard token: %v", ErrSelfTestFailed, err)
+	}
+	if !NewAlarmSystem(sp, wildcardToken, identifier).Test(ciphertexts) {
+		return fmt.Errorf("%w: all-wildcard token does not match", ErrSelfTestFailed)
+	}
+
+	if len(agents) > 0 {
+		pinned[0] = 0
+		mismatchToken, err := rg.NewToken(pinned)
+		if err != nil {
+			return fmt.Errorf("%w: creating mismatching token: %v", ErrSelfTestFailed, err)
+		}
+		if NewAlarmSystem(sp, mismatchToken, identifier).Test(ciphertexts) {
+			return fmt.Errorf("%w: token matches ciphertexts of a different value", ErrSelfTestFailed)
+		}
+	}
+	return nil
+}
+
+// VerifyAgainst checks that the keys of the agent match the information the
+// rule generator holds about it: the beta slices must be equal, g1alpha and
+// g2alpha must be powers of g1 and g2 with the same exponent, which is checked
+// with e(g1alpha, g2) == e(g1, g2alpha), and g2gamma must equal g2^gamma. It
+// can be used to diagnose keys that were stored and loaded separately. The
+// returned error wraps ErrKeyMismatch and describes the first key that differs.
+func (a *Agent) VerifyAgainst(info AgentInfo) error {
+	if err := a.sp.checkOpen(); err != nil {
+		return err
+	}
+	if len(a.beta) != len(info.beta) {
+		return fmt.Errorf("%w: agent has %d beta keys, the information %d", ErrKeyMismatch, len(a.beta), len(info.beta))
+	}
+	for i := range a.beta {
+		if !a.beta[i].Equals(info.beta[i]) {
+			return fmt.Errorf("%w: beta key %d differs", ErrKeyMismatch, i)
+		}
+	}
+	sp := a.sp
+	if !sp.pairing.NewGT().Pair(a.g1alpha, sp.g2).Equals(sp.pairing.NewGT().Pair(sp.g1, info.g2alpha)) {
+		return fmt.Errorf("%w: alpha differs", ErrKeyMismatch)
+	}
+	if !sp.pairing.NewG2().PowZn(sp.g2, a.gamma).Equals(info.g2gamma) {
+		return fmt.Errorf("%w: gamma differs", ErrKeyMismatch)
+	}
+	return nil
+}
+
+// AgentKeyError reports the agent whose keys failed to verify.
+type AgentKeyError struct {
+	Index int
+	Err   error
+}
+
+func (e *AgentKeyError) Error() string {
+	return fmt.Sprintf("Keys of agent %d: %v", e.Index, e.Err)
+}
+
+func (e *AgentKeyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify checks that the keys generated for the rule generator and the agents
+// are consistent: for every agent, e(g1alpha, g2) == e(g1, g2alpha), g2gamma
+// is g2^gamma and the beta keys are equal, as checked by VerifyAgainst. It
+// returns an *AgentKeyError for the first agent that fails, wrapping
+// ErrKeyMismatch. Verify can be called right after GenerateKeys to catch a
+// broken key generation early.
+func (sk *SetupKey) Verify(rg *RuleGenerator, agents []*Agent) error {
+	if err := sk.sp.checkOpen(); err != nil {
+		return err
+	}
+	if len(agents) != len(rg.agents) {
+		return fmt.Errorf("%w: %d agents supplied, but the rule generator knows %d agents", ErrKeyMismatch, len(agents), len(rg.agents))
+	}
+	for i, agent := range agents {
+		if agent.index != i {
+			return &AgentKeyError{Index: i, Err: fmt.Errorf("%w: agent has index %d", ErrKeyMismatch, agent.index)}
+		}
+		if err := agent.VerifyAgainst(rg.agents[i]); err != nil {
+			return &AgentKeyError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// randomIdentifier returns a fresh random identifier.
+func randomIdentifier() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("%w: generating identifier: %v", ErrSelfTestFailed, err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,65 @@
+package crypmonsys
+
+import (
+	"errors"
+	"github.com/Nik-U/pbc"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	if err := testSetupKey.sp.SelfTest(agents, rulegenerator); err != nil {
+		t.Fatal("Self-test failed on a consistent system: ", err)
+	}
+
+	if err := testSetupKey.sp.SelfTest(agents[:2], rulegenerator); !errors.Is(err, ErrSelfTestFailed) {
+		t.Fatal("Expected ErrSelfTestFailed with a missing agent, got: ", err)
+	}
+
+	// Corrupt the key of one of the agents.
+	agents[1].gamma = testSetupKey.sp.pairing.NewZr().Rand()
+	if err := testSetupKey.sp.SelfTest(agents, rulegenerator); !errors.Is(err, ErrSelfTestFailed) {
+		t.Fatal("Expected ErrSelfTestFailed with a corrupted key, got: ", err)
+	}
+}
+
+func TestVerifyAgainst(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	for i, agent := range agents {
+		if err := agent.VerifyAgainst(rulegenerator.agents[i]); err != nil {
+			t.Fatal("Consistent keys failed to verify: ", err)
+		}
+	}
+	if err := agents[0].VerifyAgainst(rulegenerator.agents[1]); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatal("Expected ErrKeyMismatch for the information of another agent, got: ", err)
+	}
+
+	// Tamper with a copy of the beta slice, as the agent and the rule
+	// generator share the original.
+	tampered := *agents[2]
+	tampered.beta = append([]*pbc.Element(nil), agents[2].beta...)
+	tampered.beta[3] = testSetupKey.sp.pairing.NewZr().Rand()
+	if err := tampered.VerifyAgainst(rulegenerator.agents[2]); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatal("Expected ErrKeyMismatch for a tampered beta key, got: ", err)
+	} else {
+		t.Log("Tampered key detected, as expected: ", err)
+	}
+}
+
+func TestSetupKeyVerify(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	if err := testSetupKey.Verify(rulegenerator, agents); err != nil {
+		t.Fatal("Freshly generated keys failed to verify: ", err)
+	}
+
+	rulegenerator.agents[1].g2alpha = testSetupKey.sp.pairing.NewG2().Rand()
+	err := testSetupKey.Verify(rulegenerator, agents)
+	var keyErr *AgentKeyError
+	if !errors.As(err, &keyErr) || keyErr.Index != 1 || !errors.Is(err, ErrKeyMismatch) {
+		t.Fatal("Expected an AgentKeyError for agent 1, got: ", err)
+	}
+	t.Log("Corrupted key detected, as expected: ", err)
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Nik-U/pbc"
+)
+
+// testVectorParams are the parameters of the Type F curve used for test
+// vectors.
+const testVectorParams = `type f
+q 205523667896953300194896352429254920972540065223
+r 205523667896953300194895899082072403858390252929
+b 40218105156867728698573668525883168222119515413
+beta 115334401956802802075595682801335644058796914268
+alpha0 191079354656274778837764015557338301375963168470
+alpha1 71445317903696340296199556072836940741717506375
+`
+
+// The shape of the system of a test vector bundle.
+const (
+	testVectorAgents = 3
+	testVectorBits   = 8
+)
+
+// TestVectorBundle holds test vectors for the scheme: the encoded system
+// derived from a seed, a token and a number of cases with ciphertexts and the
+// expected outcome of testing them against the token. Bundles can be
+// serialized as JSON, so they can be consumed by other implementations.
+type TestVectorBundle struct {
+	Seed             []byte
+	SystemParameters []byte
+	Agents           [][]byte
+	RuleGenerator    []byte
+	Rule             []int32
+	Token            []byte
+	Cases            []TestVectorCase
+}
+
+// TestVectorCase holds the ciphertexts of all agents for an identifier and
+// whether they match the token of the bundle.
+type TestVectorCase struct {
+	Identifier  string
+	Plaintexts  []int32
+	Ciphertexts [][]byte
+	Match       bool
+}
+
+// deriveTestVectorSystem derives the system of a test vector bundle from its
+// seed. Only the key material is deterministic; ciphertexts and tokens
+// contain fresh randomness.
+func deriveTestVectorSystem(seed []byte) (*SystemParameters, *RuleGenerator, []*Agent, error) {
+	params, err := pbc.NewParamsFromString(testVectorParams)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidParams, err)
+	}
+	sp := NewSystemParametersFromParams(params, WithHashedGenerators(string(seed)))
+	rg, agents := NewSetupKeyFromSeed(sp, seed).GenerateKeys(testVectorAgents, testVectorBits)
+	return sp, rg, agents, nil
+}
+
+// GenerateTestVectors generates a test vector bundle for the system derived
+// from seed.
+func GenerateTestVectors(seed []byte) (*TestVectorBundle, error) {
+	sp, rg, agents, err := deriveTestVectorSystem(seed)
+	if err != nil {
+		return nil, err
+	}
+	b := &TestVectorBundle{
+		Seed: append([]byte(nil), seed...),
+		Rule: []int32{16, Wildcard, 12},
+	}
+	if b.SystemParameters, err = sp.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	for _, agent := range agents {
+		data, err := agent.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b.Agents = append(b.Agents, data)
+	}
+	if b.RuleGenerator, err = rg.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	rt, err := rg.NewToken(b.Rule)
+	if err != nil {
+		return nil, err
+	}
+	if b.Token, err = rt.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	cases := []struct {
+		identifier string
+		plaintexts []int32
+	}{
+		{"identifier", []int32{16, 42, 12}},
+		{"identifier", []int32{16, 0, 12}},
+		{"identifier", []int32{16, 42, 13}},
+		{"other identifier", []int32{15, 42, 12}},
+	}
+	for _, c := range cases {
+		tc := TestVectorCase{Identifier: c.identifier, Plaintexts: c.plaintexts}
+		ct := make([]*Ciphertext, len(agents))
+		for i, agent := range agents {
+			ct[i] = agent.NewCiphertext(c.identifier, c.plaintexts[i])
+			data, err := ct[i].MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			tc.Ciphertexts = append(tc.Ciphertexts, data)
+		}
+		tc.Match = NewAlarmSystem(sp, rt, c.identifier).Test(ct)
+		b.Cases = append(b.Cases, tc)
+	}
+	return b, nil
+}
+
+// VerifyTestVectors checks a test vector bundle. The system is derived from the
+// seed again and must encode to the bundled system, and every case must have
+// the recorded outcome when its ciphertexts are tested against the bundled
+// token. The returned error describes the first check that failed.
+func VerifyTestVectors(b *TestVectorBundle) error {
+	sp, rg, agents, err := deriveTestVectorSystem(b.Seed)
+	if err != nil {
+		return err
+	}
+	encoded, err := sp.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(encoded, b.SystemParameters) {
+		return errors.New("Test vectors: system parameters differ.")
+	}
+	if len(b.Agents) != len(agents) {
+		return fmt.Errorf("Test vectors: bundle has %d agents, expected %d.", len(b.Agents), len(agents))
+	}
+	for i, agent := range agents {
+		if encoded, err = agent.MarshalBinary(); err != nil {
+			return err
+		}
+		if !bytes.Equal(encoded, b.Agents[i]) {
+			return fmt.Errorf("Test vectors: keys of agent %d differ.", i)
+		}
+	}
+	if encoded, err = rg.MarshalBinary(); err != nil {
+		return err
+	}
+	if !bytes.Equal(encoded, b.RuleGenerator) {
+		return errors.New("Test vectors: rule generator differs.")
+	}
+
+	rt, err := sp.UnmarshalRuleToken(b.Token)
+	if err != nil {
+		return fmt.Errorf("Test vectors: decoding token: %w", err)
+	}
+	for i, tc := range b.Cases {
+		ct := make([]*Ciphertext, len(tc.Ciphertexts))
+		for j, data := range tc.Ciphertexts {
+			if ct[j], err = sp.UnmarshalCiphertext(data); err != nil {
+				return fmt.Errorf("Test vectors: decoding ciphertext %d of case %d: %w", j, i, err)
+			}
+		}
+		if NewAlarmSystem(sp, rt, tc.Identifier).Test(ct) != tc.Match {
+			return fmt.Errorf("Test vectors: case %d does not have the recorded outcome %v.", i, tc.Match)
+		}
+	}
+	return nil
+}
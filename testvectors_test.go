@@ -0,0 +1,68 @@
+package crypmonsys
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden test vectors in testdata")
+
+const goldenTestVectors = "testdata/testvectors.json"
+
+func TestTestVectors(t *testing.T) {
+	bundle, err := GenerateTestVectors([]byte("test vectors"))
+	if err != nil {
+		t.Fatal("Error generating test vectors: ", err)
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal("Error encoding test vectors: ", err)
+	}
+	var decoded TestVectorBundle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal("Error decoding test vectors: ", err)
+	}
+	if err := VerifyTestVectors(&decoded); err != nil {
+		t.Fatal("Error verifying test vectors: ", err)
+	}
+
+	decoded.Cases[0].Match = !decoded.Cases[0].Match
+	if err := VerifyTestVectors(&decoded); err == nil {
+		t.Fatal("Test vectors with a wrong outcome verified.")
+	}
+	decoded.Cases[0].Match = !decoded.Cases[0].Match
+	decoded.Seed = []byte("other seed")
+	if err := VerifyTestVectors(&decoded); err == nil {
+		t.Fatal("Test vectors with a different seed verified.")
+	}
+}
+
+func TestGoldenTestVectors(t *testing.T) {
+	if *update {
+		bundle, err := GenerateTestVectors([]byte("crypmonsys golden test vectors"))
+		if err != nil {
+			t.Fatal("Error generating test vectors: ", err)
+		}
+		data, err := json.MarshalIndent(bundle, "", "\t")
+		if err != nil {
+			t.Fatal("Error encoding test vectors: ", err)
+		}
+		if err := os.WriteFile(goldenTestVectors, append(data, '\n'), 0644); err != nil {
+			t.Fatal("Error writing test vectors: ", err)
+		}
+	}
+
+	data, err := os.ReadFile(goldenTestVectors)
+	if err != nil {
+		t.Fatal("Error reading golden test vectors, run the test with -update to generate them: ", err)
+	}
+	var bundle TestVectorBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatal("Error decoding test vectors: ", err)
+	}
+	if err := VerifyTestVectors(&bundle); err != nil {
+		t.Fatal("Golden test vectors failed to verify: ", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 Maarten H. Everts and Tim R. van de Kamp.
+// All rights reserved.
+// Use of this source code is governed by the MIT license that can be
+// found in the LICENSE file.
+
+package crypmonsys
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/Nik-U/pbc"
+	"sort"
+)
+
+// ErrTokenSecretMismatch is an error that is issued when a token secret does
+// not belong to the token it is used with.
+var ErrTokenSecretMismatch = errors.New("Token secret does not belong to the rule token.")
+
+// Fingerprint returns a SHA-256 hash of the canonical form of the token: the
+// pinned indices in ascending order with their group elements, followed by the
+// product. For a token generated by NewTokenComposite, a marker and the index
+// of its agent precede them. Equal tokens have the same fingerprint.
+//
+// Every token contains fresh randomness, so two tokens generated for the same
+// rule have different fingerprints. The fingerprint identifies a token
+// instance, not a rule.
+func (rt *RuleToken) Fingerprint() [32]byte {
+	order := make([]int, len(rt.indices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return rt.indices[order[i]] < rt.indices[order[j]] })
+
+	h := sha256.New()
+	var buf [8]byte
+	writeBytes := func(b []byte) {
+		binary.BigEndian.PutUint64(buf[:], uint64(len(b)))
+		h.Write(buf[:])
+		h.Write(b)
+	}
+	if rt.composite {
+		h.Write([]byte{tagCompositeToken})
+		binary.BigEndian.PutUint64(buf[:], uint64(rt.agent))
+		h.Write(buf[:])
+	}
+	binary.BigEndian.PutUint64(buf[:], uint64(len(order)))
+	h.Write(buf[:])
+	for _, i := range order {
+		binary.BigEndian.PutUint64(buf[:], uint64(rt.indices[i]))
+		h.Write(buf[:])
+		writeBytes(rt.g2u[i].Bytes())
+		writeBytes(rt.f2u[i].Bytes())
+	}
+	writeBytes(rt.product.Bytes())
+
+	var fingerprint [32]byte
+	copy(fingerprint[:], h.Sum(nil))
+	return fingerprint
+}
+
+// Coverage returns the indices of the agents pinned by the token in ascending
+// order, and the arity of the token, which is the largest pinned index plus
+// one. Wildcards after the last pinned agent leave no trace in a token, so the
+// arity is a lower bound on the number of agents the token was built for. A
+// token generated by NewTokenComposite covers its agent if it pins any of its
+// attributes.
+func (rt *RuleToken) Coverage() (covered []int, arity int) {
+	covered = append([]int(nil), rt.agents()...)
+	sort.Ints(covered)
+	if len(covered) > 0 {
+		arity = covered[len(covered)-1] + 1
+	}
+	return covered, arity
+}
+
+// agents returns the indices of the agents constrained by the token. The
+// result must not be modified.
+func (rt *RuleToken) agents() []int {
+	if !rt.composite {
+		return rt.indices
+	}
+	if len(rt.indices) == 0 {
+		return nil
+	}
+	return []int{rt.agent}
+}
+
+// ciphertextAt returns the ciphertext at position v of ct that the token
+// tests, or nil if it is missing. The ciphertexts of a token generated by
+// NewTokenComposite must be of the agent of the token.
+func (rt *RuleToken) ciphertextAt(ct []*Ciphertext, v int) *Ciphertext {
+	if v >= len(ct) || ct[v] == nil || (rt.composite && ct[v].index != rt.agent) {
+		return nil
+	}
+	return ct[v]
+}
+
+// CombineTokens returns the conjunction of the tokens: a token that matches a
+// set of ciphertexts if all tokens match it. The tokens must be generated by
+// the same rule generator, for the same system parameters. The combined token
+// consists of fresh elements, so the tokens are never modified and can still
+// be used on their own. Tokens generated by NewTokenComposite can only be
+// combined with each other, for the same agent. It returns ErrMalformedToken if
+// any of the tokens is malformed and ErrCompositeMismatch if composite tokens
+// are combined with other tokens.
+func (sp *SystemParameters) CombineTokens(tokens ...*RuleToken) (*RuleToken, error) {
+	if err := sp.checkOpen(); err != nil {
+		return nil, err
+	}
+	combined := &RuleToken{
+		indices: []int{},
+		g2u:     []*pbc.Element{},
+		f2u:     []*pbc.Element{},
+		// A fresh accumulator, as multiplying in place would change the
+		// product of the first token.
+		product: sp.pairing.NewG2().Set1(),
+	}
+	for n, rt := range tokens {
+		if err := rt.check(); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			combined.composite, combined.agent = rt.composite, rt.agent
+		} else if rt.composite != combined.composite || rt.agent != combined.agent {
+			return nil, ErrCompositeMismatch
+		}
+		combined.indices = append(combined.indices, rt.indices...)
+		for i := range rt.indices {
+			combined.g2u = append(combined.g2u, sp.pairing.NewG2().Set(rt.g2u[i]))
+			combined.f2u = append(combined.f2u, sp.pairing.NewG2().Set(rt.f2u[i]))
+		}
+		combined.product.ThenMul(rt.product)
+	}
+	sp.collector().IncTokens()
+	sp.logTokenIssued(combined)
+	return combined, nil
+}
+
+// clone returns a copy of the token that shares no elements with it. A
+// malformed token is returned as is, as it is never evaluated.
+func (rt *RuleToken) clone(sp *SystemParameters) *RuleToken {
+	if rt.check() != nil {
+		return rt
+	}
+	c := &RuleToken{
+		indices:   append([]int(nil), rt.indices...),
+		g2u:       make([]*pbc.Element, len(rt.g2u)),
+		f2u:       make([]*pbc.Element, len(rt.f2u)),
+		product:   sp.pairing.NewG2().Set(rt.product),
+		composite: rt.composite,
+		agent:     rt.agent,
+	}
+	for i := range rt.g2u {
+		c.g2u[i] = sp.pairing.NewG2().Set(rt.g2u[i])
+		c.f2u[i] = sp.pairing.NewG2().Set(rt.f2u[i])
+	}
+	return c
+}
+
+// check returns ErrMalformedToken if the parallel slices of the token disagree
+// in length or if any of its components is missing.
+func (rt *RuleToken) check() error {
+	if rt == nil || rt.product == nil || len(rt.g2u) != len(rt.indices) || len(rt.f2u) != len(rt.indices) {
+		return ErrMalformedToken
+	}
+	for i, v := range rt.indices {
+		if v < 0 || rt.g2u[i] == nil || rt.f2u[i] == nil {
+			return ErrMalformedToken
+		}
+	}
+	return nil
+}
+
+// TokenSecret holds the pinned values of a rule token and the contribution of
+// every pinned agent to its product. It allows the rule generator to relax the
+// token later on. The secret must stay with the rule generator: whoever holds
+// it knows the rule of the token.
+type TokenSecret struct {
+	indices       []int
+	values        []int32
+	contributions []*pbc.Element
+}
+
+// NewTokenWithSecret generates a new rule token like NewToken, together with
+// the secret needed to remove constraints from it with RemoveConstraint.
+func (rg *RuleGenerator) NewTokenWithSecret(rules []int32) (*RuleToken, *TokenSecret, error) {
+	rt, contributions, err := rg.newToken(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	ts := &TokenSecret{
+		indices:       append([]int(nil), rt.indices...),
+		contributions: contributions,
+	}
+	for _, v := range rules {
+		if v >= 0 {
+			ts.values = append(ts.values, v)
+		}
+	}
+	return rt, ts, nil
+}
+
+// RemoveConstraint returns a token for the rule of rt in which the agent with
+// the given index is a wildcard, together with the secret of the new token.
+// The new token is generated with fresh randomness and shares no elements with
+// rt. Dividing the contribution of the agent out of the product of rt instead
+// would let whoever holds both tokens recover that contribution, and with it
+// test the value of the removed agent on its own. It returns
+// ErrTokenSecretMismatch if ts does not belong to rt, and ErrInvalidAgentIndex
+// if the agent is not pinned by rt.
+func (rg *RuleGenerator) RemoveConstraint(rt *RuleToken, ts *TokenSecret, index int) (*RuleToken, *TokenSecret, error) {
+	if err := rt.check(); err != nil {
+		return nil, nil, err
+	}
+	if ts == nil || len(ts.indices) != len(rt.indices) || len(ts.values) != len(rt.indices) {
+		return nil, nil, ErrTokenSecretMismatch
+	}
+	product := rg.sp.pairing.NewG2().Set1()
+	pos := -1
+	for i, v := range rt.indices {
+		if ts.indices[i] != v || v >= len(rg.agents) {
+			return nil, nil, ErrTokenSecretMismatch
+		}
+		product.ThenMul(ts.contributions[i])
+		if v == index {
+			pos = i
+		}
+	}
+	if !product.Equals(rt.product) {
+		return nil, nil, ErrTokenSecretMismatch
+	}
+	if pos < 0 {
+		return nil, nil, ErrInvalidAgentIndex
+	}
+
+	relaxed := rg.emptyToken()
+	secret := &TokenSecret{}
+	_, g2pp := rg.sp.generatorPowers()
+	for i, v := range ts.indices {
+		if i == pos {
+			continue
+		}
+		secret.indices = append(secret.indices, v)
+		secret.values = append(secret.values, ts.values[i])
+		secret.contributions = append(secret.contributions, relaxed.pin(rg.sp, g2pp, v, rg.agents[v], ts.values[i]))
+	}
+	rg.issued(relaxed)
+	return relaxed, secret, nil
+}
@@ -0,0 +1,205 @@
+package crypmonsys
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(3, 8)
+
+	ruletoken1, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ruletoken2, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	if ruletoken1.Fingerprint() != ruletoken1.Fingerprint() {
+		t.Fatal("Fingerprint of a token is not stable.")
+	}
+
+	copied := &RuleToken{
+		indices: append([]int(nil), ruletoken1.indices...),
+		g2u:     ruletoken1.g2u,
+		f2u:     ruletoken1.f2u,
+		product: testSetupKey.sp.pairing.NewG2().Set(ruletoken1.product),
+	}
+	if copied.Fingerprint() != ruletoken1.Fingerprint() {
+		t.Fatal("Identical tokens have different fingerprints.")
+	}
+
+	// Both tokens encode the same rule, but with different randomness.
+	if ruletoken1.Fingerprint() == ruletoken2.Fingerprint() {
+		t.Fatal("Different token instances have the same fingerprint.")
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	rulegenerator, _ := testSetupKey.GenerateKeys(5, 8)
+
+	ruletoken, err := rulegenerator.NewToken([]int32{1, Wildcard, 2, Wildcard, 3})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+
+	covered, arity := ruletoken.Coverage()
+	if arity != 5 {
+		t.Fatalf("Got arity %d, expected 5.", arity)
+	}
+	expected := []int{0, 2, 4}
+	if len(covered) != len(expected) {
+		t.Fatalf("Got covered indices %v, expected %v.", covered, expected)
+	}
+	for i := range expected {
+		if covered[i] != expected[i] {
+			t.Fatalf("Got covered indices %v, expected %v.", covered, expected)
+		}
+	}
+
+	if covered, arity := rulegenerator.NewWildcardToken().Coverage(); len(covered) != 0 || arity != 0 {
+		t.Fatalf("Wildcard token covers %v with arity %d.", covered, arity)
+	}
+}
+
+func TestMalformedToken(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+
+	identifier := "identifier"
+
+	ruletoken, err := rulegenerator.NewToken([]int32{16, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext(identifier, 16),
+		agents[1].NewCiphertext(identifier, 42),
+		agents[2].NewCiphertext(identifier, 12),
+	}
+
+	// Drop the last element of f2u.
+	ruletoken.f2u = ruletoken.f2u[:len(ruletoken.f2u)-1]
+
+	alarmsystem := NewAlarmSystem(testSetupKey.sp, ruletoken, identifier)
+	if _, err := alarmsystem.TestChecked(ciphertexts); err != ErrMalformedToken {
+		t.Fatal("Expected ErrMalformedToken, got: ", err)
+	}
+	if alarmsystem.Test(ciphertexts) {
+		t.Fatal("Alarm was raised for a malformed token.")
+	}
+	if NewAlarmSystemMulti(testSetupKey.sp, []*RuleToken{ruletoken}, identifier).EvaluateAll(ciphertexts)[0] {
+		t.Fatal("Alarm was raised for a malformed token.")
+	}
+}
+
+func TestRemoveConstraint(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	ruletoken, secret, err := rulegenerator.NewTokenWithSecret([]int32{16, 42, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	relaxed, relaxedSecret, err := rulegenerator.RemoveConstraint(ruletoken, secret, 1)
+	if err != nil {
+		t.Fatal("Error removing constraint: ", err)
+	}
+	if covered, _ := relaxed.Coverage(); len(covered) != 2 || covered[0] != 0 || covered[1] != 2 {
+		t.Fatalf("Relaxed token covers %v, expected [0 2].", covered)
+	}
+	for i := range relaxed.g2u {
+		for j := range ruletoken.g2u {
+			if relaxed.g2u[i].Equals(ruletoken.g2u[j]) || relaxed.f2u[i].Equals(ruletoken.f2u[j]) {
+				t.Fatal("Relaxed token shares elements with the original token.")
+			}
+		}
+	}
+
+	for _, v := range []int32{42, 0, 255} {
+		ciphertexts := []*Ciphertext{
+			agents[0].NewCiphertext("identifier", 16),
+			agents[1].NewCiphertext("identifier", v),
+			agents[2].NewCiphertext("identifier", 12),
+		}
+		if !NewAlarmSystem(sp, relaxed, "identifier").Test(ciphertexts) {
+			t.Fatalf("Relaxed token did not match value %d of the removed agent.", v)
+		}
+		if NewAlarmSystem(sp, ruletoken, "identifier").Test(ciphertexts) != (v == 42) {
+			t.Fatalf("Original token changed for value %d.", v)
+		}
+	}
+	ciphertexts := []*Ciphertext{
+		agents[0].NewCiphertext("identifier", 16),
+		agents[1].NewCiphertext("identifier", 42),
+		agents[2].NewCiphertext("identifier", 13),
+	}
+	if NewAlarmSystem(sp, relaxed, "identifier").Test(ciphertexts) {
+		t.Fatal("Relaxed token matched a different value of a pinned agent.")
+	}
+
+	if _, _, err := rulegenerator.RemoveConstraint(relaxed, relaxedSecret, 1); err != ErrInvalidAgentIndex {
+		t.Fatal("Expected ErrInvalidAgentIndex for an unpinned agent, got: ", err)
+	}
+	if _, _, err := rulegenerator.RemoveConstraint(relaxed, secret, 0); err != ErrTokenSecretMismatch {
+		t.Fatal("Expected ErrTokenSecretMismatch for the secret of another token, got: ", err)
+	}
+}
+
+func TestCombineTokens(t *testing.T) {
+	rulegenerator, agents := testSetupKey.GenerateKeys(3, 8)
+	sp := testSetupKey.sp
+
+	ruletoken1, err := rulegenerator.NewToken([]int32{16, -1, -1})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	ruletoken2, err := rulegenerator.NewToken([]int32{-1, -1, 12})
+	if err != nil {
+		t.Fatal("Error creating token: ", err)
+	}
+	fingerprint1, fingerprint2 := ruletoken1.Fingerprint(), ruletoken2.Fingerprint()
+
+	ciphertexts := func(v0, v2 int32) []*Ciphertext {
+		return []*Ciphertext{
+			agents[0].NewCiphertext("identifier", v0),
+			agents[1].NewCiphertext("identifier", 42),
+			agents[2].NewCiphertext("identifier", v2),
+		}
+	}
+	test := func(rt *RuleToken, ct []*Ciphertext) bool {
+		return NewAlarmSystem(sp, rt, "identifier").Test(ct)
+	}
+
+	// Combine concurrently, so the race detector catches shared writes.
+	var wg sync.WaitGroup
+	combined := make([]*RuleToken, 8)
+	errs := make([]error, len(combined))
+	for i := range combined {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			combined[i], errs[i] = sp.CombineTokens(ruletoken1, ruletoken2)
+		}(i)
+	}
+	wg.Wait()
+	for i := range combined {
+		if errs[i] != nil {
+			t.Fatal("Error combining tokens: ", errs[i])
+		}
+		if !test(combined[i], ciphertexts(16, 12)) || test(combined[i], ciphertexts(16, 13)) || test(combined[i], ciphertexts(15, 12)) {
+			t.Fatal("Combined token does not match the conjunction of the tokens.")
+		}
+	}
+
+	if ruletoken1.Fingerprint() != fingerprint1 || ruletoken2.Fingerprint() != fingerprint2 {
+		t.Fatal("Combining changed the tokens.")
+	}
+	if !test(ruletoken1, ciphertexts(16, 13)) || test(ruletoken1, ciphertexts(15, 12)) {
+		t.Fatal("First token no longer evaluates correctly on its own.")
+	}
+	if !test(ruletoken2, ciphertexts(15, 12)) || test(ruletoken2, ciphertexts(16, 13)) {
+		t.Fatal("Second token no longer evaluates correctly on its own.")
+	}
+}